@@ -0,0 +1,246 @@
+package grpcwebserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	protocolGrpcWeb     = "grpc-web"
+	protocolGrpcWebText = "grpc-web-text"
+	protocolWebsocket   = "websocket"
+	protocolGrpc        = "grpc"
+	protocolH2C         = "h2c"
+	protocolJSON        = "json"
+	protocolHTTP        = "http"
+
+	requestIDHeader  = "X-Request-Id"
+	maxRequestIDSize = 128
+)
+
+// requestInfo is collected for every request and passed in the context.
+type requestInfo struct {
+	requestID string
+	remoteIP  string
+	protocol  string
+
+	// metadata are headers passed to gRPC as metadata,
+	// also for websocket streams which get headers from the first message.
+	metadata http.Header
+
+	bytesIn    *atomic.Int64
+	bytesOut   *atomic.Int64
+	grpcStatus *atomic.String
+}
+
+// requestProtocol returns protocol of the request for logs.
+func requestProtocol(req *http.Request) string {
+	ct := req.Header.Get("Content-Type")
+	switch {
+	case isH2CPriorKnowledge(req):
+		return protocolH2C
+	case isWebsocketRequest(req):
+		return protocolWebsocket
+	case strings.HasPrefix(ct, grpcWebTextContentType):
+		return protocolGrpcWebText
+	case strings.HasPrefix(ct, grpcWebContentType):
+		return protocolGrpcWeb
+	case isNativeGrpcRequest(req):
+		return protocolGrpc
+	default:
+		return protocolHTTP
+	}
+}
+
+// bridgeRequest propagates or generates request ID and sets X-Request-Id,
+// X-Forwarded-For, User-Agent and session request headers, so they are passed
+// to gRPC metadata and seen by grpcutils.ParseRequestMetaData.
+func (s *Server) bridgeRequest(w http.ResponseWriter, req *http.Request) (*http.Request, *requestInfo) {
+	id := req.Header.Get(requestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	w.Header().Set(requestIDHeader, id)
+
+	ip := remoteIP(req)
+	forwardedFor := ip
+	if s.opts.trustForwardedFor {
+		if vv := req.Header["X-Forwarded-For"]; len(vv) > 0 {
+			forwardedFor = strings.Join(vv, ", ") + ", " + ip
+		}
+	}
+
+	info := &requestInfo{
+		requestID:  id,
+		remoteIP:   strings.TrimSpace(strings.Split(forwardedFor, ",")[0]),
+		protocol:   requestProtocol(req),
+		metadata:   make(http.Header),
+		bytesIn:    atomic.NewInt64(0),
+		bytesOut:   atomic.NewInt64(0),
+		grpcStatus: atomic.NewString(""),
+	}
+	info.metadata.Set(requestIDHeader, id)
+	info.metadata.Set("X-Forwarded-For", forwardedFor)
+	if ua := req.Header.Get("User-Agent"); ua != "" {
+		info.metadata.Set("User-Agent", ua)
+	}
+	if s.opts.session != nil {
+		s.opts.session.sessionMetadata(req, info.metadata)
+	}
+	for k, vv := range info.metadata {
+		req.Header[k] = vv
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &countingBody{ReadCloser: req.Body, n: info.bytesIn}
+	}
+	return req.WithContext(context.WithValue(req.Context(), requestInfoCtxKey, info)), info
+}
+
+// logRequest writes access log entry.
+func (s *Server) logRequest(req *http.Request, info *requestInfo, w *statusWriter, d time.Duration) {
+	code := w.status
+	if w.hijacked {
+		code = http.StatusSwitchingProtocols
+	} else if code == 0 {
+		code = http.StatusOK
+	}
+
+	fields := []zap.Field{
+		zap.String("method", req.Method),
+		zap.String("path", req.URL.Path),
+		zap.Int("status", code),
+		zap.Int64("bytes_in", info.bytesIn.Load()),
+		zap.Int64("bytes_out", info.bytesOut.Load()),
+		zap.Duration("duration", d),
+		zap.String("protocol", info.protocol),
+		zap.String("request_id", info.requestID),
+		zap.String("remote_ip", info.remoteIP),
+	}
+	if grpcStatus := info.grpcStatus.Load(); grpcStatus != "" {
+		fields = append(fields, zap.String("grpc_status", grpcStatus))
+	}
+
+	l := zap.L().Named("grpcWebAccess")
+	if info.protocol == protocolWebsocket {
+		l.Info("Websocket session.", fields...)
+	} else {
+		l.Info("Request.", fields...)
+	}
+}
+
+// setGrpcStatus records status of the gRPC call served by the request.
+func setGrpcStatus(ctx context.Context, code codes.Code) {
+	if info := getRequestInfo(ctx); info != nil {
+		info.grpcStatus.Store(strconv.Itoa(int(code)))
+	}
+}
+
+// statusHeader returns grpc-status set by the gRPC server as a header or trailer.
+func statusHeader(h http.Header) string {
+	if v := h.Get("Grpc-Status"); v != "" {
+		return v
+	}
+	return h.Get(http2.TrailerPrefix + "Grpc-Status")
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDSize {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// remoteIP returns IP address of the connected client.
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// countingBody counts bytes read from the request body.
+type countingBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// statusWriter records response status and size.
+type statusWriter struct {
+	http.ResponseWriter
+	status   int
+	n        *atomic.Int64
+	hijacked bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) CloseNotify() <-chan bool {
+	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("grpcwebserver: connection does not support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
@@ -0,0 +1,46 @@
+package grpcwebserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBridgeRequest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		opts         []Option
+		requestID    string
+		forwardedFor []string
+		wantID       string
+		wantFor      string
+	}{
+		{"propagate", nil, "abc-123", []string{"1.1.1.1"}, "abc-123", "192.0.2.1"},
+		{"generate", nil, "bad id", nil, "", "192.0.2.1"},
+		{"trusted", []Option{WithTrustForwardedFor()}, "", []string{"1.1.1.1", "2.2.2.2"}, "", "1.1.1.1, 2.2.2.2, 192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		s := &Server{opts: newOptions(tt.opts)}
+		req := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+		req.Header.Set("X-Request-Id", tt.requestID)
+		req.Header["X-Forwarded-For"] = tt.forwardedFor
+		rec := httptest.NewRecorder()
+
+		req, info := s.bridgeRequest(rec, req)
+
+		if tt.wantID != "" {
+			assert.Equal(t, tt.wantID, info.requestID, tt.name)
+		} else {
+			assert.Len(t, info.requestID, 32, tt.name)
+		}
+		assert.Equal(t, info.requestID, rec.Header().Get("X-Request-Id"), tt.name)
+		assert.Equal(t, info.requestID, req.Header.Get("X-Request-Id"), tt.name)
+		assert.Equal(t, []string{tt.wantFor}, req.Header["X-Forwarded-For"], tt.name)
+		assert.Equal(t, info, getRequestInfo(req.Context()), tt.name)
+	}
+}
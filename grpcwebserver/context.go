@@ -0,0 +1,16 @@
+package grpcwebserver
+
+import "context"
+
+type ctxType int
+
+const (
+	clientCertCtxKey ctxType = iota
+	requestInfoCtxKey
+)
+
+// getRequestInfo returns requestInfo from the context or nil.
+func getRequestInfo(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoCtxKey).(*requestInfo)
+	return info
+}
@@ -0,0 +1,246 @@
+package grpcwebserver
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy describes which browser origins may call the grpc-web endpoints.
+//
+// The zero value allows same-origin requests only. A request is same-origin if
+// the Origin scheme and host match the request; behind a TLS-terminating proxy
+// list the public origin in AllowedOrigins.
+type CORSPolicy struct {
+	// AllowedOrigins is a list of allowed origins. An entry is either an exact
+	// origin ("https://example.com"), a wildcard subdomain
+	// ("https://*.example.com") or "*" to allow any origin.
+	AllowedOrigins []string
+	// AllowedOriginPatterns are matched against the full Origin header value,
+	// they are anchored at both ends.
+	AllowedOriginPatterns []*regexp.Regexp
+	// AllowCredentials allows cookies and authorization headers on cross-origin requests.
+	// It can't be combined with "*" in AllowedOrigins.
+	AllowCredentials bool
+	// AllowedHeaders are request headers the browser may send in addition to the grpc-web ones.
+	AllowedHeaders []string
+	// ExposedHeaders are response headers the browser may read in addition to
+	// grpc-status, grpc-message and grpc-status-details-bin.
+	ExposedHeaders []string
+	// MaxAge is how long the browser may cache a preflight response.
+	// Defaults to 10 minutes.
+	MaxAge time.Duration
+}
+
+var (
+	defaultAllowedHeaders = []string{
+		"x-grpc-web",
+		"x-user-agent",
+		"content-type",
+		"content-length",
+		"accept-encoding",
+		"grpc-timeout",
+	}
+	defaultExposedHeaders = []string{
+		"grpc-status",
+		"grpc-message",
+		"grpc-status-details-bin",
+		"x-request-id",
+	}
+)
+
+const defaultCORSMaxAge = 10 * time.Minute
+
+// validate rejects policies which allow credentialed requests from any origin.
+func (p CORSPolicy) validate() error {
+	if !p.AllowCredentials {
+		return nil
+	}
+	for _, o := range p.AllowedOrigins {
+		if o == "*" {
+			return errors.New(`grpcwebserver: CORS policy can't allow credentials for "*" origin`)
+		}
+	}
+	return nil
+}
+
+type wildcardOrigin struct {
+	prefix string
+	suffix string
+}
+
+func (w wildcardOrigin) match(origin string) bool {
+	return len(origin) > len(w.prefix)+len(w.suffix) &&
+		strings.HasPrefix(origin, w.prefix) &&
+		strings.HasSuffix(origin, w.suffix)
+}
+
+// corsPolicy is a compiled CORSPolicy.
+type corsPolicy struct {
+	allowAll         bool
+	origins          map[string]struct{}
+	wildcards        []wildcardOrigin
+	patterns         []*regexp.Regexp
+	allowCredentials bool
+	allowedHeaders   string
+	exposedHeaders   string
+	maxAge           string
+}
+
+func newCORSPolicy(p CORSPolicy, extraHeaders []string) *corsPolicy {
+	c := &corsPolicy{
+		origins:          make(map[string]struct{}),
+		allowCredentials: p.AllowCredentials,
+	}
+
+	for _, re := range p.AllowedOriginPatterns {
+		c.patterns = append(c.patterns, regexp.MustCompile(`^(?:`+re.String()+`)$`))
+	}
+	for _, o := range p.AllowedOrigins {
+		o = strings.ToLower(o)
+		switch i := strings.IndexByte(o, '*'); {
+		case o == "*":
+			c.allowAll = true
+		case i >= 0:
+			c.wildcards = append(c.wildcards, wildcardOrigin{prefix: o[:i], suffix: o[i+1:]})
+		default:
+			c.origins[o] = struct{}{}
+		}
+	}
+
+	headers := append([]string{}, defaultAllowedHeaders...)
+	headers = append(headers, extraHeaders...)
+	headers = append(headers, p.AllowedHeaders...)
+	c.allowedHeaders = strings.Join(headers, ", ")
+
+	exposed := append([]string{}, defaultExposedHeaders...)
+	exposed = append(exposed, p.ExposedHeaders...)
+	c.exposedHeaders = strings.Join(exposed, ", ")
+
+	maxAge := p.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultCORSMaxAge
+	}
+	c.maxAge = strconv.Itoa(int(maxAge / time.Second))
+
+	return c
+}
+
+// allowOrigin reports whether cross-origin requests from origin are allowed.
+func (c *corsPolicy) allowOrigin(origin string) bool {
+	if c.allowAll {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if _, ok := c.origins[origin]; ok {
+		return true
+	}
+	for _, w := range c.wildcards {
+		if w.match(origin) {
+			return true
+		}
+	}
+	for _, p := range c.patterns {
+		if p.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowRequest reports whether the request is same-origin, comes from a
+// non-browser client (no Origin header) or from an allowed origin.
+func (c *corsPolicy) allowRequest(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" || isSameOrigin(req, origin) {
+		return true
+	}
+	return c.allowOrigin(origin)
+}
+
+// setHeaders sets CORS headers for an allowed actual request.
+func (c *corsPolicy) setHeaders(w http.ResponseWriter, req *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if c.allowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// handlePreflight responds to a CORS preflight request.
+// It reports whether the origin is allowed.
+func (c *corsPolicy) handlePreflight(w http.ResponseWriter, req *http.Request) bool {
+	if !c.allowRequest(req) {
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+
+	c.setHeaders(w, req)
+	h := w.Header()
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	h.Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	h.Set("Access-Control-Allow-Headers", c.allowedHeaders)
+	h.Set("Access-Control-Max-Age", c.maxAge)
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+func isSameOrigin(req *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return strings.EqualFold(u.Scheme, scheme) && strings.EqualFold(u.Host, req.Host)
+}
+
+// exposeHeadersWriter appends the configured headers to
+// Access-Control-Expose-Headers set by the grpc-web wrapper.
+type exposeHeadersWriter struct {
+	http.ResponseWriter
+	exposed     string
+	wroteHeader bool
+}
+
+func (w *exposeHeadersWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		if v := h.Get("Access-Control-Expose-Headers"); v != "" {
+			h.Set("Access-Control-Expose-Headers", v+", "+w.exposed)
+		} else {
+			h.Set("Access-Control-Expose-Headers", w.exposed)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *exposeHeadersWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *exposeHeadersWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *exposeHeadersWriter) CloseNotify() <-chan bool {
+	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
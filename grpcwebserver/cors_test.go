@@ -0,0 +1,96 @@
+package grpcwebserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSPolicyAllowOrigin(t *testing.T) {
+	t.Parallel()
+	c := newCORSPolicy(CORSPolicy{
+		AllowedOrigins: []string{
+			"https://example.com",
+			"https://*.example.org",
+		},
+		AllowedOriginPatterns: []*regexp.Regexp{
+			regexp.MustCompile(`^http://localhost:\d+$`),
+			regexp.MustCompile(`https://.*\.example\.net`),
+		},
+	}, nil)
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://example.com", true},
+		{"https://EXAMPLE.com", true},
+		{"http://example.com", false},
+		{"https://evil-example.com", false},
+		{"https://app.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://.example.org", false},
+		{"http://localhost:3000", true},
+		{"http://localhost", false},
+		{"https://app.example.net", true},
+		{"https://evil.example.net.attacker.com", false},
+		{"https://app.example.org.attacker.com", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, c.allowOrigin(tt.origin), "origin %s", tt.origin)
+	}
+}
+
+func TestCORSPolicyPreflight(t *testing.T) {
+	t.Parallel()
+	c := newCORSPolicy(CORSPolicy{
+		AllowedOrigins:   []string{"https://example.com"},
+		AllowCredentials: true,
+	}, []string{"authorization"})
+
+	req := httptest.NewRequest(http.MethodOptions, "http://api.example.com/pkg.Service/Method", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Headers", "x-grpc-web,authorization")
+	rec := httptest.NewRecorder()
+	c.handlePreflight(rec, req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, rec.Header().Get("Access-Control-Allow-Headers"), "authorization")
+
+	req.Header.Set("Origin", "https://evil.com")
+	rec = httptest.NewRecorder()
+	c.handlePreflight(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSPolicySameOrigin(t *testing.T) {
+	t.Parallel()
+	c := newCORSPolicy(CORSPolicy{}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "http://api.example.com/pkg.Service/Method", nil)
+	req.Header.Set("Origin", "http://api.example.com")
+	assert.True(t, c.allowRequest(req))
+
+	req.Header.Set("Origin", "https://api.example.com")
+	assert.False(t, c.allowRequest(req))
+
+	req = httptest.NewRequest(http.MethodPost, "https://api.example.com/pkg.Service/Method", nil)
+	req.Header.Set("Origin", "https://api.example.com")
+	assert.True(t, c.allowRequest(req))
+}
+
+func TestCORSPolicyValidate(t *testing.T) {
+	t.Parallel()
+	assert.NoError(t, CORSPolicy{AllowedOrigins: []string{"*"}}.validate())
+	assert.NoError(t, CORSPolicy{AllowedOrigins: []string{"https://example.com"}, AllowCredentials: true}.validate())
+	assert.Error(t, CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}.validate())
+}
@@ -0,0 +1,53 @@
+package grpcwebserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// serviceMethods returns methods of the service declared in the registered
+// proto file. Keys are method names.
+func serviceMethods(file, service string) (map[string]*descriptor.MethodDescriptorProto, error) {
+	gz := proto.FileDescriptor(file)
+	if gz == nil {
+		return nil, errors.New("proto file is not registered: " + file)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	fd := &descriptor.FileDescriptorProto{}
+	if err := proto.Unmarshal(b, fd); err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*descriptor.MethodDescriptorProto)
+	for _, sd := range fd.GetService() {
+		name := sd.GetName()
+		if fd.GetPackage() != "" {
+			name = fd.GetPackage() + "." + name
+		}
+		if name != service {
+			continue
+		}
+		for _, md := range sd.GetMethod() {
+			res[md.GetName()] = md
+		}
+	}
+	return res, nil
+}
+
+// messageType returns the fully-qualified message name without leading dot.
+func messageType(name string) string {
+	return strings.TrimPrefix(name, ".")
+}
@@ -0,0 +1,238 @@
+package grpcwebserver
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// Recent call counts on the service directory page are kept in minute buckets.
+const (
+	statsBuckets      = 5
+	statsBucketPeriod = time.Minute
+)
+
+type statsBucket struct {
+	start  int64 // bucket number since epoch
+	calls  uint64
+	errors uint64
+}
+
+type methodStats struct {
+	calls   uint64
+	errors  uint64
+	buckets [statsBuckets]statsBucket
+}
+
+// callStats counts calls and errors per method in total and for the last minutes.
+type callStats struct {
+	mu      sync.Mutex
+	methods map[string]*methodStats
+}
+
+func newCallStats() *callStats {
+	return &callStats{
+		methods: make(map[string]*methodStats),
+	}
+}
+
+func (c *callStats) record(method string, code codes.Code, now time.Time) {
+	n := now.UnixNano() / int64(statsBucketPeriod)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.methods[method]
+	if m == nil {
+		m = &methodStats{}
+		c.methods[method] = m
+	}
+	b := &m.buckets[n%statsBuckets]
+	if b.start != n {
+		*b = statsBucket{start: n}
+	}
+	m.calls++
+	b.calls++
+	if code != codes.OK {
+		m.errors++
+		b.errors++
+	}
+}
+
+// get returns total and recent counts of calls and errors.
+func (c *callStats) get(method string, now time.Time) (calls, errors, recentCalls, recentErrors uint64) {
+	n := now.UnixNano() / int64(statsBucketPeriod)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.methods[method]
+	if m == nil {
+		return
+	}
+	for _, b := range m.buckets {
+		if n-b.start < statsBuckets {
+			recentCalls += b.calls
+			recentErrors += b.errors
+		}
+	}
+	return m.calls, m.errors, recentCalls, recentErrors
+}
+
+// recordStats records stats of the gRPC call served by the request.
+func (s *Server) recordStats(req *http.Request, info *requestInfo) {
+	switch info.protocol {
+	case protocolGrpcWeb, protocolGrpcWebText, protocolWebsocket, protocolGrpc, protocolJSON:
+	default:
+		return
+	}
+	if !s.isRegisteredMethod(req.URL.Path) {
+		return
+	}
+
+	code := codes.Unknown
+	if n, err := strconv.Atoi(info.grpcStatus.Load()); err == nil {
+		code = codes.Code(n)
+	}
+	s.stats.record(req.URL.Path, code, time.Now())
+}
+
+type directoryMethod struct {
+	Name         string
+	Type         string
+	Exposed      bool
+	Transports   []string
+	Calls        uint64
+	ErrorRate    string
+	RecentCalls  uint64
+	RecentErrors string
+}
+
+type directoryService struct {
+	Name    string
+	Methods []directoryMethod
+}
+
+var directoryTemplate = template.Must(template.New("directory").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>gRPC services</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+.hidden { color: #999; }
+</style>
+</head>
+<body>
+<h1>gRPC services</h1>
+<p>{{with .TracePrefix}}Traces: <a href="{{.}}/requests">{{.}}/requests</a>, <a href="{{.}}/events">{{.}}/events</a>.
+{{end}}Recent counts are for the last {{.Window}}.</p>
+{{range .Services}}
+<h2>{{.Name}}</h2>
+<table>
+<tr><th>Method</th><th>Type</th><th>Exposed</th><th>Transports</th><th>Calls</th><th>Errors</th><th>Recent calls</th><th>Recent errors</th></tr>
+{{range .Methods}}
+<tr{{if not .Exposed}} class="hidden"{{end}}>
+<td>{{.Name}}</td><td>{{.Type}}</td><td>{{if .Exposed}}yes{{else}}no{{end}}</td>
+<td>{{range $i, $t := .Transports}}{{if $i}}, {{end}}{{$t}}{{end}}</td>
+<td>{{.Calls}}</td><td>{{.ErrorRate}}</td><td>{{.RecentCalls}}</td><td>{{.RecentErrors}}</td>
+</tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+// ServiceDirectory returns a debug page listing services and methods
+// registered on the gRPC server: streaming type, whether a method is exposed
+// and over which transports, call counts and error rates. The page links to
+// x/net/trace pages under tracePrefix, e.g. "/debug", empty tracePrefix
+// hides the links. Serve it on an internal debug listener only, e.g. with
+// prometheusutils.DebugServer.Handle.
+func (s *Server) ServiceDirectory(tracePrefix string) http.Handler {
+	tracePrefix = strings.TrimSuffix(tracePrefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.serveDirectory(w, req, tracePrefix)
+	})
+}
+
+func (s *Server) serveDirectory(w http.ResponseWriter, req *http.Request, tracePrefix string) {
+	now := time.Now()
+	var services []directoryService
+	for name, info := range s.grpc.GetServiceInfo() {
+		service := directoryService{Name: name}
+		for _, m := range info.Methods {
+			method := "/" + name + "/" + m.Name
+			dm := directoryMethod{
+				Name:    m.Name,
+				Type:    streamingType(m.IsClientStream, m.IsServerStream),
+				Exposed: s.opts.methods.allowed(method),
+			}
+			if dm.Exposed {
+				dm.Transports = s.methodTransports(m.IsClientStream)
+			}
+			var calls, errors, recentErrors uint64
+			calls, errors, dm.RecentCalls, recentErrors = s.stats.get(method, now)
+			dm.Calls = calls
+			dm.ErrorRate = errorRate(errors, calls)
+			dm.RecentErrors = errorRate(recentErrors, dm.RecentCalls)
+			service.Methods = append(service.Methods, dm)
+		}
+		sort.Slice(service.Methods, func(i, j int) bool { return service.Methods[i].Name < service.Methods[j].Name })
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := directoryTemplate.Execute(w, struct {
+		TracePrefix string
+		Window      time.Duration
+		Services    []directoryService
+	}{tracePrefix, statsBuckets * statsBucketPeriod, services})
+	if err != nil {
+		zap.L().Warn("GrpcWeb service directory error.", zap.Error(err))
+	}
+}
+
+// methodTransports returns transports serving the method.
+func (s *Server) methodTransports(clientStream bool) []string {
+	var transports []string
+	if !clientStream {
+		transports = append(transports, protocolGrpcWeb, protocolGrpcWebText)
+	}
+	transports = append(transports, protocolWebsocket)
+	if s.opts.json != nil && !clientStream {
+		transports = append(transports, protocolJSON)
+	}
+	if s.opts.nativeGRPC {
+		transports = append(transports, protocolGrpc)
+	}
+	return transports
+}
+
+func streamingType(clientStream, serverStream bool) string {
+	switch {
+	case clientStream && serverStream:
+		return "bidi streaming"
+	case clientStream:
+		return "client streaming"
+	case serverStream:
+		return "server streaming"
+	default:
+		return "unary"
+	}
+}
+
+func errorRate(errors, calls uint64) string {
+	if calls == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(float64(errors)/float64(calls)*100, 'f', 1, 64) + "%"
+}
@@ -0,0 +1,72 @@
+package grpcwebserver
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gebv/go-utils/prometheusutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestCallStats(t *testing.T) {
+	t.Parallel()
+	c := newCallStats()
+	now := time.Unix(1000*60, 0)
+	c.record("/pkg.Service/Get", codes.OK, now.Add(-10*time.Minute))
+	c.record("/pkg.Service/Get", codes.OK, now.Add(-time.Minute))
+	c.record("/pkg.Service/Get", codes.Internal, now)
+
+	calls, errors, recentCalls, recentErrors := c.get("/pkg.Service/Get", now)
+	assert.Equal(t, uint64(3), calls)
+	assert.Equal(t, uint64(1), errors)
+	assert.Equal(t, uint64(2), recentCalls)
+	assert.Equal(t, uint64(1), recentErrors)
+}
+
+func TestServiceDirectory(t *testing.T) {
+	t.Parallel()
+	gs := grpc.NewServer()
+	gs.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "pkg.Service",
+		HandlerType: (*interface{})(nil),
+		Methods:     []grpc.MethodDesc{{MethodName: "Get"}},
+		Streams:     []grpc.StreamDesc{{StreamName: "Watch", ServerStreams: true}},
+	}, struct{}{})
+	gs.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "pkg.Admin",
+		HandlerType: (*interface{})(nil),
+		Methods:     []grpc.MethodDesc{{MethodName: "Delete"}},
+	}, struct{}{})
+
+	s := New(gs, "127.0.0.1:0", WithMethodFilter(MethodFilter{Deny: []string{"pkg.Admin/*"}}))
+	debug := prometheusutils.NewDebugServer("127.0.0.1:0", prometheusutils.WithTrace())
+	debug.Handle("/debug/grpc", s.ServiceDirectory("/debug"))
+
+	require.NoError(t, debug.Start())
+	defer debug.Shutdown(context.Background())
+
+	resp, err := http.Get("http://" + debug.Addr().String() + "/debug/grpc")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body := string(b)
+	assert.Contains(t, body, "<h2>pkg.Service</h2>")
+	assert.Contains(t, body, "<td>Watch</td><td>server streaming</td><td>yes</td>")
+	assert.Contains(t, body, `<tr class="hidden">`)
+	assert.Contains(t, body, `href="/debug/requests"`)
+	assert.Contains(t, body, `href="/debug/events"`)
+
+	rec := httptest.NewRecorder()
+	s.ServiceDirectory("").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, rec.Body.String(), "<h2>pkg.Service</h2>")
+	assert.NotContains(t, rec.Body.String(), "/requests")
+}
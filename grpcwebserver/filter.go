@@ -0,0 +1,104 @@
+package grpcwebserver
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// MethodFilter selects gRPC methods exposed by the server.
+//
+// Rules are globs matched against full method names "/package.Service/Method",
+// the leading slash may be omitted: "package.Service/*", "*/Get*". Deny rules
+// win over Allow rules, with no Allow rules all methods are allowed.
+// The filter applies to all transports, native gRPC included.
+type MethodFilter struct {
+	Allow []string
+	Deny  []string
+	// DeniedCode is returned for filtered methods: codes.Unimplemented (default)
+	// hides them, codes.PermissionDenied makes it explicit.
+	DeniedCode codes.Code
+}
+
+func normalizeMethodRule(rule string) string {
+	if !strings.HasPrefix(rule, "/") {
+		return "/" + rule
+	}
+	return rule
+}
+
+// validate checks glob syntax of the rules.
+func (f *MethodFilter) validate() error {
+	for _, rule := range append(append([]string{}, f.Allow...), f.Deny...) {
+		if _, err := path.Match(normalizeMethodRule(rule), "/"); err != nil {
+			return fmt.Errorf("grpcwebserver: invalid method rule %q: %s", rule, err)
+		}
+	}
+	return nil
+}
+
+func matchMethod(rules []string, method string) bool {
+	for _, rule := range rules {
+		if ok, _ := path.Match(normalizeMethodRule(rule), method); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed reports whether the full method name is exposed.
+func (f *MethodFilter) allowed(method string) bool {
+	if f == nil {
+		return true
+	}
+	if matchMethod(f.Deny, method) {
+		return false
+	}
+	return len(f.Allow) == 0 || matchMethod(f.Allow, method)
+}
+
+// status returns the status for a filtered method.
+func (f *MethodFilter) status(method string) (codes.Code, string) {
+	if f.DeniedCode == codes.OK || f.DeniedCode == codes.Unimplemented {
+		return codes.Unimplemented, fmt.Sprintf("unknown method %s", method)
+	}
+	return f.DeniedCode, fmt.Sprintf("method %s is not exposed", method)
+}
+
+// filterMethod writes a trailers-only gRPC response for a filtered method.
+// It reports whether the method is allowed.
+func (s *Server) filterMethod(w http.ResponseWriter, req *http.Request) bool {
+	if s.opts.methods.allowed(req.URL.Path) {
+		return true
+	}
+	code, msg := s.opts.methods.status(req.URL.Path)
+	setGrpcStatus(req.Context(), code)
+	h := w.Header()
+	h.Set("Content-Type", req.Header.Get("Content-Type"))
+	setStatus(h, code, msg)
+	w.WriteHeader(http.StatusOK)
+	return false
+}
+
+// logExposedMethods logs methods exposed and hidden by the method filter.
+func (s *Server) logExposedMethods() {
+	var exposed, hidden []string
+	for name, info := range s.grpc.GetServiceInfo() {
+		for _, m := range info.Methods {
+			method := "/" + name + "/" + m.Name
+			if s.opts.methods.allowed(method) {
+				exposed = append(exposed, method)
+			} else {
+				hidden = append(hidden, method)
+			}
+		}
+	}
+	sort.Strings(exposed)
+	sort.Strings(hidden)
+	zap.L().Info("GrpcWeb exposed methods.", zap.Strings("exposed", exposed), zap.Strings("hidden", hidden))
+}
@@ -0,0 +1,57 @@
+package grpcwebserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+)
+
+func TestMethodFilter(t *testing.T) {
+	t.Parallel()
+	f := &MethodFilter{
+		Allow: []string{"pkg.Public/*", "/pkg.Users/*"},
+		Deny:  []string{"*/Delete*"},
+	}
+	assert.NoError(t, f.validate())
+
+	tests := []struct {
+		method  string
+		allowed bool
+	}{
+		{"/pkg.Public/Get", true},
+		{"/pkg.Users/List", true},
+		{"/pkg.Users/DeleteUser", false},
+		{"/pkg.Admin/Get", false},
+		{"/pkg.PublicAdmin/Get", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, f.allowed(tt.method), tt.method)
+	}
+
+	var nilFilter *MethodFilter
+	assert.True(t, nilFilter.allowed("/pkg.Admin/Get"))
+	assert.Error(t, (&MethodFilter{Deny: []string{"pkg.[/*"}}).validate())
+}
+
+func TestFilterMethod(t *testing.T) {
+	t.Parallel()
+	s := &Server{opts: newOptions([]Option{WithMethodFilter(MethodFilter{
+		Deny:       []string{"pkg.Admin/*"},
+		DeniedCode: codes.PermissionDenied,
+	})})}
+
+	req := httptest.NewRequest(http.MethodPost, "/pkg.Admin/Get", nil)
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	rec := httptest.NewRecorder()
+	assert.False(t, s.filterMethod(rec, req))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/grpc-web+proto", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "7", rec.Header().Get("Grpc-Status"))
+	assert.Equal(t, "method /pkg.Admin/Get is not exposed", rec.Header().Get("Grpc-Message"))
+
+	req = httptest.NewRequest(http.MethodPost, "/pkg.Public/Get", nil)
+	assert.True(t, s.filterMethod(httptest.NewRecorder(), req))
+}
@@ -0,0 +1,83 @@
+package grpcwebserver
+
+import "sync"
+
+// hijacked is a connection taken over from http.Server, such as a websocket stream.
+type hijacked interface {
+	// close forcibly closes the connection.
+	close()
+}
+
+// hijackTracker keeps track of hijacked connections so they can be closed on
+// shutdown: http.Server does not track them.
+type hijackTracker struct {
+	mu       sync.Mutex
+	conns    map[hijacked]struct{}
+	closing  bool
+	drained  chan struct{}
+	draining bool
+}
+
+func newHijackTracker() *hijackTracker {
+	return &hijackTracker{
+		conns:   make(map[hijacked]struct{}),
+		drained: make(chan struct{}),
+	}
+}
+
+// add registers a connection. It returns false if the server is shutting down.
+func (t *hijackTracker) add(c hijacked) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.conns[c] = struct{}{}
+	return true
+}
+
+func (t *hijackTracker) remove(c hijacked) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns, c)
+	if t.draining && len(t.conns) == 0 && !t.closing {
+		t.closing = true
+		close(t.drained)
+	}
+}
+
+// len returns the number of open connections.
+func (t *hijackTracker) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.conns)
+}
+
+// drain stops accepting new connections and returns a channel closed once all
+// open connections are finished.
+func (t *hijackTracker) drain() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.draining = true
+	if len(t.conns) == 0 && !t.closing {
+		t.closing = true
+		close(t.drained)
+	}
+	return t.drained
+}
+
+// isDraining reports whether drain was called.
+func (t *hijackTracker) isDraining() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.draining
+}
+
+// closeAll forcibly closes all open connections.
+func (t *hijackTracker) closeAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for c := range t.conns {
+		c.close()
+	}
+}
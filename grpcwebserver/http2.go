@@ -0,0 +1,79 @@
+package grpcwebserver
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+)
+
+// h2cPreface is the remainder of HTTP/2 client preface after "PRI * HTTP/2.0\r\n\r\n"
+// which is parsed by http.Server as a request.
+const h2cPreface = "SM\r\n\r\n"
+
+// isNativeGrpcRequest reports whether req is a gRPC request over HTTP/2.
+func isNativeGrpcRequest(req *http.Request) bool {
+	return req.ProtoMajor == 2 && req.Method == http.MethodPost &&
+		strings.HasPrefix(req.Header.Get("Content-Type"), grpcContentType) &&
+		!strings.HasPrefix(req.Header.Get("Content-Type"), grpcWebContentType)
+}
+
+// isH2CPriorKnowledge reports whether req starts a cleartext HTTP/2 connection.
+func isH2CPriorKnowledge(req *http.Request) bool {
+	return req.Method == "PRI" && req.RequestURI == "*" && req.ProtoMajor == 2 && req.ProtoMinor == 0
+}
+
+// h2cConn is a hijacked cleartext HTTP/2 connection.
+type h2cConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *h2cConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *h2cConn) close() {
+	c.Conn.Close()
+}
+
+// serveH2C takes over the connection and serves it as HTTP/2 with prior knowledge.
+func (s *Server) serveH2C(w http.ResponseWriter, req *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "HTTP/2 is not supported.", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		zap.L().Warn("GrpcWeb h2c hijack error.", zap.Error(err))
+		return
+	}
+
+	buf := make([]byte, len(h2cPreface))
+	if _, err := io.ReadFull(rw, buf); err != nil || !bytes.Equal(buf, []byte(h2cPreface)) {
+		zap.L().Warn("GrpcWeb invalid h2c preface.", zap.Error(err))
+		conn.Close()
+		return
+	}
+
+	// http2.Server expects to read the whole client preface.
+	c := &h2cConn{
+		Conn: conn,
+		r:    io.MultiReader(strings.NewReader(http2.ClientPreface), rw.Reader),
+	}
+	if !s.hijacked.add(c) {
+		conn.Close()
+		return
+	}
+	defer s.hijacked.remove(c)
+
+	s.h2.ServeConn(c, &http2.ServeConnOpts{
+		BaseConfig: s.srv,
+		Handler:    s,
+	})
+}
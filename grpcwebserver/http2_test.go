@@ -0,0 +1,134 @@
+package grpcwebserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// lockedBuffer is a log sink safe for concurrent writes.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Sync() error { return nil }
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs replaces the global logger until the test ends.
+func captureLogs(t *testing.T) *lockedBuffer {
+	buf := new(lockedBuffer)
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), buf, zap.DebugLevel)
+	t.Cleanup(zap.ReplaceGlobals(zap.New(core)))
+	return buf
+}
+
+// requestsTotal returns requests_total series as "transport method code".
+func requestsTotal(t *testing.T, m *Metrics) []string {
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(m))
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	var series []string
+	for _, mf := range mfs {
+		if mf.GetName() != "test_requests_total" {
+			continue
+		}
+		for _, metric := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, lp := range metric.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			series = append(series, labels["transport"]+" "+labels["method"]+" "+labels["code"])
+		}
+	}
+	return series
+}
+
+func TestServerNativeGRPC(t *testing.T) {
+	logs := captureLogs(t)
+	metrics := NewMetrics("test")
+	s := startTestServer(t, newTestService(), WithNativeGRPC(), WithAccessLog(), WithMetrics(metrics))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// native gRPC with prior knowledge
+	cc, err := grpc.DialContext(ctx, s.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	require.NoError(t, err)
+	defer cc.Close()
+	out := new(duration.Duration)
+	require.NoError(t, cc.Invoke(ctx, "/test.Service/Echo", &duration.Duration{Seconds: 2}, out))
+	assert.Equal(t, int64(2), out.Seconds)
+
+	// grpc-web on the same listener
+	resp := grpcWebCall(t, http.DefaultClient, "http://"+s.Addr().String()+"/test.Service/Echo", &duration.Duration{Seconds: 3})
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "grpc-status: 0")
+
+	assert.ElementsMatch(t, []string{"grpc /test.Service/Echo OK", "grpc-web /test.Service/Echo OK"}, requestsTotal(t, metrics))
+	assert.Equal(t, 2, strings.Count(logs.String(), `"logger":"grpcWebAccess"`), logs.String())
+	assert.NotContains(t, logs.String(), `"PRI"`)
+}
+
+func TestServerNativeGRPCOverTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", 1, nil)
+	server := newTestCert(t, "server", 2, ca)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeFile(t, certFile, server.certPEM, time.Now())
+	writeFile(t, keyFile, server.keyPEM, time.Now())
+
+	s := startTestServer(t, newTestService(), WithNativeGRPC(), WithTLS(TLSConfig{CertFile: certFile, KeyFile: keyFile}))
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// native gRPC negotiated with ALPN h2
+	creds := credentials.NewTLS(&tls.Config{RootCAs: roots})
+	cc, err := grpc.DialContext(ctx, s.Addr().String(), grpc.WithTransportCredentials(creds), grpc.WithBlock())
+	require.NoError(t, err)
+	defer cc.Close()
+	out := new(duration.Duration)
+	require.NoError(t, cc.Invoke(ctx, "/test.Service/Echo", &duration.Duration{Seconds: 2}, out))
+	assert.Equal(t, int64(2), out.Seconds)
+
+	// grpc-web over HTTP/1.1 on the same listener
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	resp := grpcWebCall(t, c, "https://"+s.Addr().String()+"/test.Service/Echo", &duration.Duration{Seconds: 3})
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, 1, resp.ProtoMajor)
+	assert.Contains(t, string(body), "grpc-status: 0")
+}
@@ -0,0 +1,139 @@
+package grpcwebserver
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// WebsocketLimits guards websocket streams. Zero values mean no limit.
+type WebsocketLimits struct {
+	// MaxStreams limits concurrent websocket streams.
+	MaxStreams int
+	// MaxStreamsPerIP limits concurrent websocket streams per client IP.
+	MaxStreamsPerIP int
+	// IdleTimeout closes streams with no messages in either direction.
+	IdleTimeout time.Duration
+	// MaxMessageSize limits the size of a client message in bytes.
+	MaxMessageSize int64
+	// PingInterval is how often pings are sent. Streams are closed if no pong
+	// is received within two intervals.
+	PingInterval time.Duration
+	// MaxLifetime closes streams with Unavailable status after the duration,
+	// so clients reconnect, e.g. to another instance.
+	MaxLifetime time.Duration
+}
+
+// reasons of websocket streams rejected or closed by limits.
+const (
+	limitMaxStreams      = "max_streams"
+	limitMaxStreamsPerIP = "max_streams_per_ip"
+	limitIdle            = "idle_timeout"
+	limitMessageSize     = "message_size"
+	limitKeepalive       = "keepalive_timeout"
+	limitLifetime        = "max_lifetime"
+)
+
+// streamLimiter counts websocket streams in total and per client IP.
+type streamLimiter struct {
+	mu    sync.Mutex
+	total int
+	perIP map[string]int
+}
+
+func newStreamLimiter() *streamLimiter {
+	return &streamLimiter{
+		perIP: make(map[string]int),
+	}
+}
+
+// acquire registers a stream. It returns a limit reason if the stream is rejected.
+func (l *streamLimiter) acquire(limits WebsocketLimits, ip string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limits.MaxStreams > 0 && l.total >= limits.MaxStreams {
+		return limitMaxStreams
+	}
+	if limits.MaxStreamsPerIP > 0 && l.perIP[ip] >= limits.MaxStreamsPerIP {
+		return limitMaxStreamsPerIP
+	}
+	l.total++
+	l.perIP[ip]++
+	return ""
+}
+
+func (l *streamLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+// websocketLimit logs and counts a websocket stream rejected or closed by limits.
+func (s *Server) websocketLimit(reason, ip, path string) {
+	zap.L().Warn("GrpcWeb websocket limit reached.", zap.String("reason", reason), zap.String("remote_ip", ip), zap.String("path", path))
+	if s.opts.metrics != nil {
+		s.opts.metrics.websocketLimits.WithLabelValues(reason).Inc()
+	}
+}
+
+// supervise sends pings and closes the stream on idle, keepalive or lifetime
+// timeouts until done is closed.
+func (s *wsStream) supervise(limits WebsocketLimits, done <-chan struct{}, onLimit func(reason string)) {
+	tick := limits.PingInterval
+	if limits.IdleTimeout > 0 && (tick == 0 || limits.IdleTimeout/2 < tick) {
+		tick = limits.IdleTimeout / 2
+	}
+	var tickC <-chan time.Time
+	if tick > 0 {
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		tickC = ticker.C
+	}
+	var lifetimeC <-chan time.Time
+	if limits.MaxLifetime > 0 {
+		timer := time.NewTimer(limits.MaxLifetime)
+		defer timer.Stop()
+		lifetimeC = timer.C
+	}
+
+	expire := func(reason, msg string) {
+		onLimit(reason)
+		s.expire(codes.Unavailable, msg)
+	}
+
+	var lastPing time.Time // the first tick pings
+	for {
+		select {
+		case <-done:
+			return
+
+		case <-lifetimeC:
+			expire(limitLifetime, "stream lifetime exceeded, reconnect")
+			return
+
+		case now := <-tickC:
+			// ticks may be more often than pings when idle timeout is shorter
+			if limits.IdleTimeout > 0 && now.Sub(time.Unix(0, s.lastActivity.Load())) > limits.IdleTimeout {
+				expire(limitIdle, "stream idle timeout")
+				return
+			}
+			if limits.PingInterval > 0 {
+				if now.Sub(time.Unix(0, s.lastPong.Load())) > 2*limits.PingInterval {
+					expire(limitKeepalive, "keepalive timeout")
+					return
+				}
+				// half a tick tolerates timer jitter, otherwise a ping may be
+				// skipped and the keepalive timeout reached without pings
+				if now.Sub(lastPing) >= limits.PingInterval-tick/2 {
+					s.ping()
+					lastPing = now
+				}
+			}
+		}
+	}
+}
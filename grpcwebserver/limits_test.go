@@ -0,0 +1,104 @@
+package grpcwebserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/gorilla/websocket"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamLimiter(t *testing.T) {
+	t.Parallel()
+	l := newStreamLimiter()
+	limits := WebsocketLimits{MaxStreams: 3, MaxStreamsPerIP: 2}
+
+	assert.Equal(t, "", l.acquire(limits, "192.0.2.1"))
+	assert.Equal(t, "", l.acquire(limits, "192.0.2.1"))
+	assert.Equal(t, limitMaxStreamsPerIP, l.acquire(limits, "192.0.2.1"))
+	assert.Equal(t, "", l.acquire(limits, "192.0.2.2"))
+	assert.Equal(t, limitMaxStreams, l.acquire(limits, "192.0.2.3"))
+
+	l.release("192.0.2.1")
+	assert.Equal(t, "", l.acquire(limits, "192.0.2.1"))
+
+	l.release("192.0.2.1")
+	l.release("192.0.2.1")
+	l.release("192.0.2.2")
+	assert.Equal(t, 0, l.total)
+	assert.Empty(t, l.perIP)
+}
+
+// limitCount returns websocket streams closed or rejected for reason.
+func limitCount(t *testing.T, m *Metrics, reason string) float64 {
+	t.Helper()
+	var metric dto.Metric
+	require.NoError(t, m.websocketLimits.WithLabelValues(reason).Write(&metric))
+	return metric.GetCounter().GetValue()
+}
+
+func TestWebsocketLimitsExpire(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		limits WebsocketLimits
+		reason string
+	}{
+		{"max lifetime", WebsocketLimits{MaxLifetime: 100 * time.Millisecond}, limitLifetime},
+		{"idle timeout", WebsocketLimits{IdleTimeout: 100 * time.Millisecond}, limitIdle},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := NewMetrics("test")
+			s := startTestServer(t, newTestService(), WithWebsocketLimits(tc.limits), WithMetrics(metrics))
+
+			conn := wsCall(t, s, "/test.Service/Wait", &duration.Duration{Seconds: 1})
+			defer conn.Close()
+			code, closeCode := wsResult(t, conn)
+			assert.Equal(t, "14", code) // Unavailable, clients reconnect
+			assert.Equal(t, websocket.CloseGoingAway, closeCode)
+			assert.Equal(t, float64(1), limitCount(t, metrics, tc.reason))
+		})
+	}
+}
+
+func TestWebsocketKeepalive(t *testing.T) {
+	svc := newTestService()
+	metrics := NewMetrics("test")
+	s := startTestServer(t, svc, WithWebsocketLimits(WebsocketLimits{PingInterval: 20 * time.Millisecond}), WithMetrics(metrics))
+
+	conn := wsCall(t, s, "/test.Service/Wait", &duration.Duration{Seconds: 1})
+	defer conn.Close()
+	var pings int
+	conn.SetPingHandler(func(data string) error {
+		pings++
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	// answered pings keep the stream open longer than the keepalive timeout
+	time.AfterFunc(200*time.Millisecond, func() { close(svc.release) })
+	code, closeCode := wsResult(t, conn)
+	assert.Equal(t, "0", code)
+	assert.Equal(t, websocket.CloseNormalClosure, closeCode)
+	assert.True(t, pings >= 3, "pings: %d", pings)
+	assert.Equal(t, float64(0), limitCount(t, metrics, limitKeepalive))
+}
+
+func TestWebsocketMaxMessageSize(t *testing.T) {
+	metrics := NewMetrics("test")
+	s := startTestServer(t, newTestService(), WithWebsocketLimits(WebsocketLimits{MaxMessageSize: 100}), WithMetrics(metrics))
+
+	d := websocket.Dialer{Subprotocols: []string{websocketProtocol}}
+	conn, _, err := d.Dial("ws://"+s.Addr().String()+"/test.Service/Echo", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte("content-type: application/grpc-web+proto\r\nx-grpc-web: 1\r\n")))
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, append([]byte{0}, make([]byte, 200)...)))
+	// the connection is closed by websocket library before trailers are written
+	_, closeCode := wsResult(t, conn)
+	assert.Equal(t, websocket.CloseMessageTooBig, closeCode)
+	for i := 0; limitCount(t, metrics, limitMessageSize) != 1; i++ {
+		require.True(t, i < 100, "message size limit is not counted")
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,133 @@
+package grpcwebserver
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+)
+
+// Metrics collects grpc-web server metrics per gRPC method and transport.
+// Register it with prometheus.Registerer and pass to WithMetrics.
+type Metrics struct {
+	requests        *prometheus.CounterVec
+	duration        *prometheus.HistogramVec
+	receivedBytes   *prometheus.CounterVec
+	sentBytes       *prometheus.CounterVec
+	websockets      prometheus.Gauge
+	preflights      prometheus.Counter
+	rejectedOrigins *prometheus.CounterVec
+	websocketLimits *prometheus.CounterVec
+}
+
+// NewMetrics returns metrics with names starting with prefix.
+func NewMetrics(prefix string) *Metrics {
+	labels := []string{"method", "transport"}
+	return &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_requests_total",
+			Help: "The total number of gRPC calls by method, transport and status code.",
+		}, append(labels, "code")),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    prefix + "_request_duration_seconds",
+			Help:    "Duration of gRPC calls, websocket sessions included.",
+			Buckets: prometheus.DefBuckets,
+		}, labels),
+		receivedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_received_bytes_total",
+			Help: "The total number of request body bytes and websocket bytes received.",
+		}, labels),
+		sentBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_sent_bytes_total",
+			Help: "The total number of response body bytes and websocket bytes sent.",
+		}, labels),
+		websockets: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prefix + "_open_websockets",
+			Help: "The number of open websocket streams.",
+		}),
+		preflights: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prefix + "_preflight_requests_total",
+			Help: "The total number of CORS preflight requests.",
+		}),
+		rejectedOrigins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_rejected_origins_total",
+			Help: "The total number of requests rejected by the origin policy.",
+		}, []string{"transport"}),
+		websocketLimits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_websocket_limits_total",
+			Help: "The total number of websocket streams rejected or closed by limits.",
+		}, []string{"reason"}),
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.requests,
+		m.duration,
+		m.receivedBytes,
+		m.sentBytes,
+		m.websockets,
+		m.preflights,
+		m.rejectedOrigins,
+		m.websocketLimits,
+	}
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// observe records a finished gRPC call.
+func (m *Metrics) observe(method string, info *requestInfo, d time.Duration) {
+	code := codes.Unknown
+	if n, err := strconv.Atoi(info.grpcStatus.Load()); err == nil {
+		code = codes.Code(n)
+	}
+	m.requests.WithLabelValues(method, info.protocol, code.String()).Inc()
+	m.duration.WithLabelValues(method, info.protocol).Observe(d.Seconds())
+	m.receivedBytes.WithLabelValues(method, info.protocol).Add(float64(info.bytesIn.Load()))
+	m.sentBytes.WithLabelValues(method, info.protocol).Add(float64(info.bytesOut.Load()))
+}
+
+// observeRequest records metrics of the gRPC call served by the request.
+func (s *Server) observeRequest(req *http.Request, info *requestInfo, d time.Duration) {
+	switch info.protocol {
+	case protocolGrpcWeb, protocolGrpcWebText, protocolWebsocket, protocolGrpc, protocolJSON:
+	default:
+		return
+	}
+	method := req.URL.Path
+	if !s.isRegisteredMethod(method) {
+		method = "unknown"
+	}
+	s.opts.metrics.observe(method, info, d)
+}
+
+// isRegisteredMethod reports whether path is a "/package.Service/Method" registered on the gRPC server.
+func (s *Server) isRegisteredMethod(path string) bool {
+	s.methodsOnce.Do(func() {
+		s.methods = make(map[string]struct{})
+		for name, info := range s.grpc.GetServiceInfo() {
+			for _, m := range info.Methods {
+				s.methods["/"+name+"/"+m.Name] = struct{}{}
+			}
+		}
+	})
+	_, ok := s.methods[path]
+	return ok
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*Metrics)(nil)
+)
@@ -0,0 +1,195 @@
+package grpcwebserver
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gebv/go-utils/httputils"
+	"github.com/golang/protobuf/jsonpb"
+)
+
+// Option configures grpc-web server.
+type Option func(o *options)
+
+type options struct {
+	cors            CORSPolicy
+	allowedHeaders  []string
+	shutdownTimeout time.Duration
+	tls             *TLSConfig
+	nativeGRPC      bool
+	json            *jsonTranscoder
+	handler         http.Handler
+	healthPath      string
+	versionPath     string
+	version         string
+	static          http.FileSystem
+	staticConfig    StaticConfig
+
+	accessLog         bool
+	trustForwardedFor bool
+	metrics           *Metrics
+	websocketLimits   WebsocketLimits
+	server            httputils.ServerOptions
+	session           *SessionConfig
+	methods           *MethodFilter
+}
+
+const defaultShutdownTimeout = 10 * time.Second
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		shutdownTimeout: defaultShutdownTimeout,
+		handler:         http.NotFoundHandler(),
+		server:          httputils.DefaultServerOptions(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithCORS sets the origin policy for grpc-web requests and websocket upgrades.
+func WithCORS(policy CORSPolicy) Option {
+	return func(o *options) {
+		o.cors = policy
+	}
+}
+
+// WithAllowedHeaders adds request headers browsers may send.
+func WithAllowedHeaders(headers []string) Option {
+	return func(o *options) {
+		o.allowedHeaders = append(o.allowedHeaders, headers...)
+	}
+}
+
+// WithShutdownTimeout sets how long RunGrpcWebServer waits for in-flight
+// requests and websocket streams on shutdown. Defaults to 10 seconds.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.shutdownTimeout = d
+	}
+}
+
+// WithTLS serves over TLS with certificates reloaded from files.
+func WithTLS(cfg TLSConfig) Option {
+	return func(o *options) {
+		o.tls = &cfg
+	}
+}
+
+// WithNativeGRPC serves native gRPC requests on the same port using HTTP/2:
+// negotiated with ALPN over TLS or with prior knowledge (h2c) over cleartext.
+func WithNativeGRPC() Option {
+	return func(o *options) {
+		o.nativeGRPC = true
+	}
+}
+
+// WithJSONTranscoding exposes unary and server streaming methods as
+// `POST /package.Service/Method` with JSON bodies. Server streaming responses
+// are newline-delimited JSON. Nil marshaler and unmarshaler default to
+// &jsonpb.Marshaler{} and &jsonpb.Unmarshaler{}.
+func WithJSONTranscoding(marshaler JSONMarshaler, unmarshaler JSONUnmarshaler) Option {
+	return func(o *options) {
+		o.json = &jsonTranscoder{
+			marshaler:   marshaler,
+			unmarshaler: unmarshaler,
+		}
+		if marshaler == nil {
+			o.json.marshaler = &jsonpb.Marshaler{}
+		}
+		if unmarshaler == nil {
+			o.json.unmarshaler = &jsonpb.Unmarshaler{}
+		}
+	}
+}
+
+// WithHandler sets the handler for requests which are not gRPC, grpc-web or
+// built-in routes. Defaults to 404 for everything: pass http.DefaultServeMux
+// explicitly to expose handlers registered on it.
+func WithHandler(h http.Handler) Option {
+	return func(o *options) {
+		o.handler = h
+	}
+}
+
+// WithHealthRoute serves the readiness state on path: 200 when the server is
+// started and 503 when it is not started or shutting down.
+func WithHealthRoute(path string) Option {
+	return func(o *options) {
+		o.healthPath = path
+	}
+}
+
+// WithVersionRoute serves `{"version": version}` on path.
+func WithVersionRoute(path, version string) Option {
+	return func(o *options) {
+		o.versionPath = path
+		o.version = version
+	}
+}
+
+// WithStaticFiles serves static assets from root for requests which are not
+// gRPC, grpc-web or built-in routes. Not found files are passed to the handler
+// set by WithHandler. See NewStaticHandler.
+func WithStaticFiles(root http.FileSystem, cfg StaticConfig) Option {
+	return func(o *options) {
+		o.static = root
+		o.staticConfig = cfg
+	}
+}
+
+// WithAccessLog logs every HTTP request and websocket session.
+func WithAccessLog() Option {
+	return func(o *options) {
+		o.accessLog = true
+	}
+}
+
+// WithTrustForwardedFor keeps X-Forwarded-For of incoming requests and appends
+// the peer address. Use it behind a trusted proxy only; by default the header
+// is replaced with the peer address.
+func WithTrustForwardedFor() Option {
+	return func(o *options) {
+		o.trustForwardedFor = true
+	}
+}
+
+// WithMetrics records request metrics. Register m with prometheus.Registerer.
+func WithMetrics(m *Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// WithWebsocketLimits limits websocket streams.
+func WithWebsocketLimits(l WebsocketLimits) Option {
+	return func(o *options) {
+		o.websocketLimits = l
+	}
+}
+
+// WithServerOptions sets HTTP server timeouts and limits.
+// Defaults to httputils.DefaultServerOptions. Read and write timeouts and body
+// limits are not applied to websockets, gRPC and grpc-web calls and streaming
+// JSON calls.
+func WithServerOptions(so httputils.ServerOptions) Option {
+	return func(o *options) {
+		o.server = so
+	}
+}
+
+// WithSession maps cookies and headers to gRPC metadata and gRPC response
+// headers to cookies, see SessionConfig.
+func WithSession(cfg SessionConfig) Option {
+	return func(o *options) {
+		o.session = &cfg
+	}
+}
+
+// WithMethodFilter exposes only methods selected by the filter.
+func WithMethodFilter(f MethodFilter) Option {
+	return func(o *options) {
+		o.methods = &f
+	}
+}
@@ -0,0 +1,39 @@
+package grpcwebserver
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// serveHealth responds 200 if the server is ready and 503 otherwise.
+func (s *Server) serveHealth(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if !s.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("not ready\n"))
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// versionHandler responds with the version as JSON.
+func versionHandler(version string) http.Handler {
+	b, _ := json.Marshal(struct {
+		Version string `json:"version"`
+	}{version})
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
+}
+
+// serveFallback serves requests which are not gRPC: built-in routes first, then
+// static files and the handler set by WithHandler.
+func (s *Server) serveFallback(w http.ResponseWriter, req *http.Request) {
+	if h, ok := s.routes[req.URL.Path]; ok && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+		h.ServeHTTP(w, req)
+		return
+	}
+	s.fallback.ServeHTTP(w, req)
+}
@@ -0,0 +1,87 @@
+package grpcwebserver
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, s *Server, path string) (int, string) {
+	t.Helper()
+	resp, err := http.Get("http://" + s.Addr().String() + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(b)
+}
+
+func TestHealthRoute(t *testing.T) {
+	svc := newTestService()
+	s := startTestServer(t, svc, WithHealthRoute("/healthz"))
+
+	code, body := get(t, s, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok\n", body)
+
+	// keep Shutdown draining with an open stream
+	conn := wsCall(t, s, "/test.Service/Wait", &duration.Duration{Seconds: 1})
+	defer conn.Close()
+	<-svc.started
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Shutdown(context.Background())
+	}()
+	for i := 0; s.Ready(); i++ {
+		require.True(t, i < 100, "server is ready after Shutdown")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "not ready\n", rec.Body.String())
+
+	close(svc.release)
+	assert.NoError(t, <-done)
+}
+
+func TestVersionRoute(t *testing.T) {
+	s := startTestServer(t, newTestService(), WithVersionRoute("/version", `v1.2.3 "rc"`))
+
+	resp, err := http.Get("http://" + s.Addr().String() + "/version")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"version": "v1.2.3 \"rc\""}`, string(b))
+}
+
+func TestUnknownRoutes(t *testing.T) {
+	s := startTestServer(t, newTestService(), WithHealthRoute("/healthz"))
+	code, _ := get(t, s, "/unknown")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte(req.URL.Path))
+	})
+	s = startTestServer(t, newTestService(), WithHealthRoute("/healthz"), WithHandler(h))
+	code, body := get(t, s, "/unknown")
+	assert.Equal(t, http.StatusTeapot, code)
+	assert.Equal(t, "/unknown", body)
+
+	// built-in routes take precedence over the handler
+	code, body = get(t, s, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok\n", body)
+}
@@ -2,66 +2,343 @@ package grpcwebserver
 
 import (
 	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
 )
 
-// RunGrpcWebServer run grpc-web server.
-func RunGrpcWebServer(ctx context.Context, s *grpc.Server, listenAddress string, allowedHeaders []string) {
-	zap.L().Info("GrpcWeb server starting.")
-	headers := []string{
-		"x-grpc-web",
-		"content-type",
-		"content-length",
-		"accept-encoding",
-	}
-
-	headers = append(headers, allowedHeaders...)
-
-	opts := []grpcweb.Option{
-		// gRPC-Web compatibility layer with CORS configured to accept on every request
-		grpcweb.WithCorsForRegisteredEndpointsOnly(false),
-		grpcweb.WithWebsockets(true),
-		grpcweb.WithWebsocketOriginFunc(func(req *http.Request) bool {
-			return true
-		}),
-		grpcweb.WithOriginFunc(func(origin string) bool {
-			return true
-		}),
-	}
-	wrappedGrpc := grpcweb.WrapServer(s, opts...)
-
-	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		if wrappedGrpc.IsAcceptableGrpcCorsRequest(req) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
-			return
+// Server is a grpc-web server for *grpc.Server.
+//
+// It serves grpc-web requests over HTTP/1.1 and gRPC streams over websockets.
+// With WithNativeGRPC it also serves native gRPC over HTTP/2 on the same port.
+type Server struct {
+	grpc     *grpc.Server
+	wrapped  *grpcweb.WrappedGrpcServer
+	opts     *options
+	cors     *corsPolicy
+	upgrader websocket.Upgrader
+	hijacked *hijackTracker
+	streams  *streamLimiter
+	stats    *callStats
+	srv      *http.Server
+	lis      net.Listener
+	certs    *certReloader
+	h2       *http2.Server
+	routes   map[string]http.Handler
+	fallback http.Handler
+	ready    *atomic.Bool
+
+	methodsOnce sync.Once
+	methods     map[string]struct{}
+}
+
+// New returns a new grpc-web server. Call Start to begin serving.
+func New(s *grpc.Server, listenAddress string, opts ...Option) *Server {
+	o := newOptions(opts)
+	server := &Server{
+		grpc:     s,
+		wrapped:  grpcweb.WrapServer(s, grpcweb.WithCorsForRegisteredEndpointsOnly(false)),
+		opts:     o,
+		cors:     newCORSPolicy(o.cors, append(o.allowedHeaders, o.session.allowedHeaders()...)),
+		hijacked: newHijackTracker(),
+		streams:  newStreamLimiter(),
+		stats:    newCallStats(),
+		ready:    atomic.NewBool(false),
+		routes:   make(map[string]http.Handler),
+	}
+	if o.healthPath != "" {
+		server.routes[o.healthPath] = http.HandlerFunc(server.serveHealth)
+	}
+	if o.versionPath != "" {
+		server.routes[o.versionPath] = versionHandler(o.version)
+	}
+	server.fallback = o.handler
+	if o.static != nil {
+		server.fallback = NewStaticHandler(o.static, o.staticConfig, o.handler)
+	}
+	server.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    []string{websocketProtocol},
+		CheckOrigin:     server.cors.allowRequest,
+	}
+	server.srv = &http.Server{Addr: listenAddress, Handler: server}
+	serverOptions := o.server
+	longLived := serverOptions.LongLived
+	serverOptions.LongLived = func(req *http.Request) bool {
+		return server.isLongLived(req) || (longLived != nil && longLived(req))
+	}
+	serverOptions.Configure(server.srv)
+	if o.nativeGRPC {
+		server.h2 = &http2.Server{}
+	}
+	return server
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if s.h2 != nil && isH2CPriorKnowledge(req) {
+		// the connection preface is not logged, requests on the connection come back here
+		s.serveH2C(w, req)
+		return
+	}
+
+	start := time.Now()
+	req = withClientCertificate(req)
+	req, info := s.bridgeRequest(w, req)
+	sw := &statusWriter{ResponseWriter: w, n: info.bytesOut}
+	s.route(sw, req)
+
+	d := time.Since(start)
+	if info.grpcStatus.Load() == "" {
+		// trailers-only grpc-web responses and native gRPC responses
+		if v := statusHeader(sw.Header()); v != "" {
+			info.grpcStatus.Store(v)
+		}
+	}
+	if s.opts.accessLog {
+		s.logRequest(req, info, sw, d)
+	}
+	s.recordStats(req, info)
+	if s.opts.metrics != nil {
+		s.observeRequest(req, info, d)
+	}
+}
+
+// route dispatches the request by protocol.
+func (s *Server) route(w http.ResponseWriter, req *http.Request) {
+	if s.wrapped.IsAcceptableGrpcCorsRequest(req) || s.isJSONPreflight(req) {
+		if s.opts.metrics != nil {
+			s.opts.metrics.preflights.Inc()
+		}
+		if !s.cors.handlePreflight(w, req) {
+			s.rejectOrigin(req, "preflight")
+		}
+		return
+	}
+	if isWebsocketRequest(req) {
+		if s.checkOrigin(w, req) {
+			s.serveWebsocket(w, req)
+		}
+		return
+	}
+	if s.wrapped.IsGrpcWebRequest(req) {
+		if s.checkOrigin(w, req) {
+			w = s.withSetCookies(&exposeHeadersWriter{ResponseWriter: w, exposed: s.cors.exposedHeaders})
+			if !s.filterMethod(w, req) {
+				return
+			}
+			if info := getRequestInfo(req.Context()); info != nil {
+				w = newTrailerWriter(w, req, info)
+			}
+			s.wrapped.HandleGrpcWebRequest(w, req)
+		}
+		return
+	}
+	if s.h2 != nil && isNativeGrpcRequest(req) {
+		if s.filterMethod(w, req) {
+			s.grpc.ServeHTTP(w, req)
 		}
-		if wrappedGrpc.IsGrpcWebSocketRequest(req) || wrappedGrpc.IsGrpcWebRequest(req) {
-			wrappedGrpc.ServeHTTP(w, req)
+		return
+	}
+	if s.opts.json != nil && isJSONRequest(req) {
+		if m := s.opts.json.method(s, req.URL.Path); m != nil {
+			if info := getRequestInfo(req.Context()); info != nil {
+				info.protocol = protocolJSON
+			}
+			if !s.checkOrigin(w, req) {
+				return
+			}
+			if !s.opts.methods.allowed(req.URL.Path) {
+				s.opts.json.writeError(w, req, status.New(s.opts.methods.status(req.URL.Path)))
+				return
+			}
+			s.opts.json.serve(s, s.withSetCookies(w), req, m)
 			return
 		}
+	}
+
+	s.serveFallback(w, req)
+}
 
-		http.DefaultServeMux.ServeHTTP(w, req)
-	})
+// withSetCookies wraps w to set cookies from gRPC response headers.
+func (s *Server) withSetCookies(w http.ResponseWriter) http.ResponseWriter {
+	if s.opts.session == nil || len(s.opts.session.SetCookies) == 0 {
+		return w
+	}
+	return &setCookieWriter{ResponseWriter: w, cookies: s.opts.session.SetCookies}
+}
+
+// isLongLived reports whether the request may be a long-lived stream.
+// Unary and streaming calls can't be distinguished for gRPC and grpc-web,
+// their message sizes are limited by the gRPC server.
+func (s *Server) isLongLived(req *http.Request) bool {
+	ct := req.Header.Get("Content-Type")
+	switch {
+	case isWebsocketRequest(req), isH2CPriorKnowledge(req):
+		return true
+	case strings.HasPrefix(ct, grpcContentType), strings.HasPrefix(ct, grpcWebContentType):
+		return true
+	case s.opts.json != nil && isJSONRequest(req):
+		m := s.opts.json.method(s, req.URL.Path)
+		return m != nil && m.serverStreams
+	}
+	return false
+}
 
-	grpcweb := &http.Server{Addr: listenAddress, Handler: handler}
-	zap.L().Info("GRPCWeb listen address", zap.String("address", listenAddress))
+// checkOrigin sets CORS headers for allowed requests and rejects requests from
+// other origins and forged cookie-authenticated requests.
+// It reports whether the request is allowed.
+func (s *Server) checkOrigin(w http.ResponseWriter, req *http.Request) bool {
+	if !s.cors.allowRequest(req) {
+		s.rejectOrigin(req, requestProtocol(req))
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+	if !s.checkCSRF(req) {
+		zap.L().Warn("GrpcWeb CSRF check failed.", zap.String("origin", req.Header.Get("Origin")), zap.String("path", req.URL.Path))
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+	if !isWebsocketRequest(req) {
+		s.cors.setHeaders(w, req)
+	}
+	return true
+}
+
+// rejectOrigin logs and counts a request rejected by the origin policy.
+func (s *Server) rejectOrigin(req *http.Request, transport string) {
+	zap.L().Warn("GrpcWeb origin rejected.", zap.String("origin", req.Header.Get("Origin")), zap.String("path", req.URL.Path))
+	if s.opts.metrics != nil {
+		s.opts.metrics.rejectedOrigins.WithLabelValues(transport).Inc()
+	}
+}
+
+// Start starts listening and serving in background.
+// It returns an error if the server can't listen on the address or load TLS certificates.
+func (s *Server) Start() error {
+	if err := s.opts.cors.validate(); err != nil {
+		return err
+	}
+	if s.opts.methods != nil {
+		if err := s.opts.methods.validate(); err != nil {
+			return err
+		}
+		s.logExposedMethods()
+	}
+	if s.opts.tls != nil {
+		certs, err := newCertReloader(*s.opts.tls)
+		if err != nil {
+			return err
+		}
+		s.certs = certs
+	}
+
+	lis, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+	lis = s.opts.server.Listener(lis)
+	if s.certs != nil {
+		nextProtos := []string{"http/1.1"}
+		if s.h2 != nil {
+			nextProtos = []string{http2.NextProtoTLS, "http/1.1"}
+		}
+		s.srv.TLSConfig = s.certs.config(nextProtos)
+	}
+	if s.h2 != nil {
+		if err := http2.ConfigureServer(s.srv, s.h2); err != nil {
+			lis.Close()
+			return err
+		}
+	}
+	if s.certs != nil {
+		lis = tls.NewListener(lis, s.srv.TLSConfig)
+		go s.certs.watch()
+	}
+	s.lis = lis
+	zap.L().Info("GRPCWeb listen address", zap.String("address", lis.Addr().String()))
+
+	s.ready.Store(true)
 	go func() {
-		if err := grpcweb.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := s.srv.Serve(lis); err != nil && err != http.ErrServerClosed {
 			zap.L().Error("GrpcWeb Serve error.", zap.Error(err))
 		}
 	}()
+	return nil
+}
+
+// Addr returns the listener address. It returns nil if the server is not started.
+func (s *Server) Addr() net.Addr {
+	if s.lis == nil {
+		return nil
+	}
+	return s.lis.Addr()
+}
+
+// Ready reports whether the server is started and not shutting down.
+func (s *Server) Ready() bool {
+	return s.ready.Load()
+}
+
+// Shutdown gracefully stops the server: it stops accepting new connections and
+// waits for in-flight requests and websocket streams to finish. When ctx is
+// done remaining websocket streams are cancelled and closed with "going away"
+// status, remaining connections are closed and ctx error is returned without
+// waiting for handlers which ignore cancellation.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.ready.Store(false)
+	if s.certs != nil {
+		s.certs.stop()
+	}
+	drained := s.hijacked.drain()
+
+	err := s.srv.Shutdown(ctx)
+	if err != nil {
+		s.srv.Close()
+	}
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		// handlers ignoring cancellation may still run, they are not waited for
+		zap.L().Warn("GrpcWeb closing hijacked connections.", zap.Int("connections", s.hijacked.len()))
+		s.hijacked.closeAll()
+		err = ctx.Err()
+	}
+	return err
+}
+
+// RunGrpcWebServer run grpc-web server.
+//
+// Cross-origin requests are rejected unless allowed with WithCORS.
+// Requests which are not grpc-web get 404 unless a handler is set with WithHandler.
+func RunGrpcWebServer(ctx context.Context, s *grpc.Server, listenAddress string, allowedHeaders []string, opts ...Option) {
+	zap.L().Info("GrpcWeb server starting.")
+
+	server := New(s, listenAddress, append(opts, WithAllowedHeaders(allowedHeaders))...)
+	if err := server.Start(); err != nil {
+		zap.L().Error("GrpcWeb server start error.", zap.Error(err))
+		return
+	}
 
 	<-ctx.Done()
 
-	if err := grpcweb.Close(); err != nil {
-		zap.L().Error("GrpcWeb server close error.", zap.Error(err))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), server.opts.shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		zap.L().Error("GrpcWeb server shutdown error.", zap.Error(err))
 	} else {
 		zap.L().Info("GrpcWeb server stopped.")
 	}
@@ -0,0 +1,253 @@
+package grpcwebserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testService echoes durations. Wait streams one response and blocks until
+// release is closed, or the call is cancelled unless ignoreCancel is set.
+type testService struct {
+	certs        chan string // common names of client certificates
+	started      chan struct{}
+	release      chan struct{}
+	ignoreCancel bool
+}
+
+func newTestService() *testService {
+	return &testService{
+		certs:   make(chan string, 10),
+		started: make(chan struct{}, 10),
+		release: make(chan struct{}),
+	}
+}
+
+func testEcho(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(duration.Duration)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if in.Seconds < 0 {
+		return nil, status.Error(codes.InvalidArgument, "negative duration")
+	}
+	if c, ok := ClientCertificate(ctx); ok {
+		srv.(*testService).certs <- c.Subject.CommonName
+	}
+	return in, nil
+}
+
+func testWait(srv interface{}, stream grpc.ServerStream) error {
+	s := srv.(*testService)
+	in := new(duration.Duration)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	if err := stream.SendMsg(in); err != nil {
+		return err
+	}
+	s.started <- struct{}{}
+	if s.ignoreCancel {
+		<-s.release
+		return nil
+	}
+	select {
+	case <-s.release:
+		return nil
+	case <-stream.Context().Done():
+		return stream.Context().Err()
+	}
+}
+
+var testServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Service",
+	HandlerType: (*interface{})(nil),
+	Methods:     []grpc.MethodDesc{{MethodName: "Echo", Handler: testEcho}},
+	Streams:     []grpc.StreamDesc{{StreamName: "Wait", Handler: testWait, ServerStreams: true}},
+	Metadata:    "grpcwebserver/test.proto",
+}
+
+// init registers the descriptor of testServiceDesc as protoc-gen-go does.
+func init() {
+	fd := &descriptor.FileDescriptorProto{
+		Name:       proto.String("grpcwebserver/test.proto"),
+		Package:    proto.String("test"),
+		Dependency: []string{"google/protobuf/duration.proto"},
+		Service: []*descriptor.ServiceDescriptorProto{{
+			Name: proto.String("Service"),
+			Method: []*descriptor.MethodDescriptorProto{{
+				Name:       proto.String("Echo"),
+				InputType:  proto.String(".google.protobuf.Duration"),
+				OutputType: proto.String(".google.protobuf.Duration"),
+			}, {
+				Name:            proto.String("Wait"),
+				InputType:       proto.String(".google.protobuf.Duration"),
+				OutputType:      proto.String(".google.protobuf.Duration"),
+				ServerStreaming: proto.Bool(true),
+			}},
+		}},
+		Syntax: proto.String("proto3"),
+	}
+	b, err := proto.Marshal(fd)
+	if err != nil {
+		panic(err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	proto.RegisterFile(fd.GetName(), buf.Bytes())
+}
+
+// startTestServer starts a server for svc on a random local port.
+func startTestServer(t *testing.T, svc *testService, opts ...Option) *Server {
+	t.Helper()
+	gs := grpc.NewServer()
+	gs.RegisterService(&testServiceDesc, svc)
+	s := New(gs, "127.0.0.1:0", opts...)
+	require.NoError(t, s.Start())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	return s
+}
+
+// grpcFrame returns a gRPC length-prefixed message.
+func grpcFrame(t *testing.T, m proto.Message) []byte {
+	t.Helper()
+	b, err := proto.Marshal(m)
+	require.NoError(t, err)
+	frame := make([]byte, 5, 5+len(b))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(b)))
+	return append(frame, b...)
+}
+
+// wsCall starts a grpc-web websocket call of method with a single request message.
+func wsCall(t *testing.T, s *Server, method string, m proto.Message) *websocket.Conn {
+	t.Helper()
+	d := websocket.Dialer{Subprotocols: []string{websocketProtocol}}
+	conn, _, err := d.Dial("ws://"+s.Addr().String()+method, nil)
+	require.NoError(t, err)
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte("content-type: application/grpc-web+proto\r\nx-grpc-web: 1\r\n")))
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, append([]byte{0}, grpcFrame(t, m)...)))
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte{1}))
+	return conn
+}
+
+// wsResult reads the call until the connection is closed and returns grpc-status and close code.
+func wsResult(t *testing.T, conn *websocket.Conn) (string, int) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var grpcStatus string
+	for {
+		_, b, err := conn.ReadMessage()
+		if err != nil {
+			closeErr, ok := err.(*websocket.CloseError)
+			require.True(t, ok, "unexpected error: %v", err)
+			return grpcStatus, closeErr.Code
+		}
+		if len(b) > 5 && b[0]&(1<<7) != 0 {
+			for _, line := range strings.Split(string(b[5:]), "\r\n") {
+				if strings.HasPrefix(strings.ToLower(line), "grpc-status:") {
+					grpcStatus = strings.TrimSpace(line[len("grpc-status:"):])
+				}
+			}
+		}
+	}
+}
+
+func TestServerGracefulShutdown(t *testing.T) {
+	svc := newTestService()
+	gs := grpc.NewServer()
+	gs.RegisterService(&testServiceDesc, svc)
+	s := New(gs, "127.0.0.1:0")
+	assert.False(t, s.Ready())
+	require.NoError(t, s.Start())
+	assert.True(t, s.Ready())
+
+	conn := wsCall(t, s, "/test.Service/Wait", &duration.Duration{Seconds: 1})
+	defer conn.Close()
+	<-svc.started
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Shutdown(context.Background())
+	}()
+	for i := 0; s.Ready() || !s.hijacked.isDraining(); i++ {
+		require.True(t, i < 100, "server is not draining")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned before the stream finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(svc.release)
+	code, closeCode := wsResult(t, conn)
+	assert.Equal(t, "0", code)
+	assert.Equal(t, websocket.CloseGoingAway, closeCode)
+	assert.NoError(t, <-done)
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	svc := newTestService()
+	svc.ignoreCancel = true
+	defer close(svc.release)
+	s := startTestServer(t, svc)
+
+	conn := wsCall(t, s, "/test.Service/Wait", &duration.Duration{Seconds: 1})
+	defer conn.Close()
+	<-svc.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Equal(t, context.DeadlineExceeded, s.Shutdown(ctx))
+	assert.True(t, time.Since(start) < time.Second, "Shutdown waited for the handler")
+
+	_, closeCode := wsResult(t, conn)
+	assert.Equal(t, websocket.CloseGoingAway, closeCode)
+}
+
+func TestServerNormalClosure(t *testing.T) {
+	svc := newTestService()
+	close(svc.release)
+	s := startTestServer(t, svc)
+
+	conn := wsCall(t, s, "/test.Service/Wait", &duration.Duration{Seconds: 1})
+	defer conn.Close()
+	code, closeCode := wsResult(t, conn)
+	assert.Equal(t, "0", code)
+	assert.Equal(t, websocket.CloseNormalClosure, closeCode)
+}
+
+// grpcWebCall makes a grpc-web unary call and returns the response.
+func grpcWebCall(t *testing.T, c *http.Client, url string, m proto.Message) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(grpcFrame(t, m)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("X-Grpc-Web", "1")
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	return resp
+}
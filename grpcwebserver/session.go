@@ -0,0 +1,175 @@
+package grpcwebserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SessionConfig maps browser cookies and headers to gRPC metadata and gRPC
+// response headers to cookies.
+//
+// Requests with any of the mapped cookies are cookie-authenticated and are
+// protected from CSRF: with CSRFCookie and CSRFHeader set the header must
+// match the cookie (double-submit token), otherwise the request must have an
+// Origin header allowed by the CORS policy. Websocket upgrades can't carry
+// custom headers, so they are always checked by Origin.
+type SessionConfig struct {
+	// Cookies maps cookie names to metadata keys, e.g. {"session": "session-id"}.
+	Cookies map[string]string
+	// Headers maps HTTP header names to metadata keys.
+	Headers map[string]string
+	// SetCookies maps gRPC response header keys to cookies. The header is
+	// removed from the response. An empty value deletes the cookie.
+	// Cookies can't be set on websocket streams. Send headers with
+	// grpc.SendHeader: the gRPC HTTP handler transport drops headers set
+	// with grpc.SetHeader.
+	SetCookies map[string]CookieConfig
+	// CSRFCookie is the name of the cookie with the double-submit token.
+	CSRFCookie string
+	// CSRFHeader is the name of the header with the double-submit token.
+	CSRFHeader string
+}
+
+// CookieConfig describes a cookie set from a gRPC response header.
+type CookieConfig struct {
+	Name     string
+	Path     string
+	Domain   string
+	MaxAge   time.Duration
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+// cookie returns the cookie with value.
+func (c CookieConfig) cookie(value string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     c.Name,
+		Value:    value,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		MaxAge:   int(c.MaxAge / time.Second),
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+		SameSite: c.SameSite,
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	if value == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// allowedHeaders returns request headers browsers may send.
+func (c *SessionConfig) allowedHeaders() []string {
+	if c == nil {
+		return nil
+	}
+	var headers []string
+	for name := range c.Headers {
+		headers = append(headers, strings.ToLower(name))
+	}
+	if c.CSRFHeader != "" {
+		headers = append(headers, strings.ToLower(c.CSRFHeader))
+	}
+	sort.Strings(headers)
+	return headers
+}
+
+// sessionMetadata adds metadata mapped from cookies and headers.
+func (c *SessionConfig) sessionMetadata(req *http.Request, md http.Header) {
+	for name, key := range c.Cookies {
+		if cookie, err := req.Cookie(name); err == nil {
+			md.Set(key, cookie.Value)
+		}
+	}
+	for name, key := range c.Headers {
+		if v := req.Header.Get(name); v != "" {
+			md.Set(key, v)
+		}
+	}
+}
+
+// cookieAuthenticated reports whether the request carries any of the mapped cookies.
+func (c *SessionConfig) cookieAuthenticated(req *http.Request) bool {
+	for name := range c.Cookies {
+		if _, err := req.Cookie(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCSRF reports whether a cookie-authenticated request is not forged.
+// Requests from disallowed origins are already rejected by checkOrigin.
+func (s *Server) checkCSRF(req *http.Request) bool {
+	c := s.opts.session
+	if c == nil || !c.cookieAuthenticated(req) {
+		return true
+	}
+
+	if c.CSRFCookie != "" && c.CSRFHeader != "" && !isWebsocketRequest(req) {
+		cookie, err := req.Cookie(c.CSRFCookie)
+		if err != nil || cookie.Value == "" {
+			return false
+		}
+		token := req.Header.Get(c.CSRFHeader)
+		return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) == 1
+	}
+	return req.Header.Get("Origin") != ""
+}
+
+// setCookieWriter replaces configured gRPC response headers with cookies.
+type setCookieWriter struct {
+	http.ResponseWriter
+	cookies     map[string]CookieConfig
+	wroteHeader bool
+}
+
+func (w *setCookieWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		for key, c := range w.cookies {
+			vv, ok := h[http.CanonicalHeaderKey(key)]
+			if !ok {
+				continue
+			}
+			h.Del(key)
+			value := ""
+			if len(vv) > 0 {
+				value = vv[0]
+			}
+			if cookie := c.cookie(value); cookie.String() != "" {
+				h.Add("Set-Cookie", cookie.String())
+			} else {
+				zap.L().Warn("GrpcWeb invalid cookie.", zap.String("name", c.Name))
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *setCookieWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *setCookieWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *setCookieWriter) CloseNotify() <-chan bool {
+	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
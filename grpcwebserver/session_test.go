@@ -0,0 +1,58 @@
+package grpcwebserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionCSRF(t *testing.T) {
+	t.Parallel()
+	cfg := SessionConfig{
+		Cookies: map[string]string{"session": "session-id"},
+	}
+	s := &Server{opts: newOptions([]Option{WithSession(cfg)})}
+
+	req := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+	assert.True(t, s.checkCSRF(req), "no cookies")
+
+	req.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+	assert.False(t, s.checkCSRF(req), "no origin")
+	req.Header.Set("Origin", "https://example.com")
+	assert.True(t, s.checkCSRF(req), "origin")
+
+	cfg.CSRFCookie = "csrf"
+	cfg.CSRFHeader = "X-CSRF-Token"
+	s = &Server{opts: newOptions([]Option{WithSession(cfg)})}
+	assert.False(t, s.checkCSRF(req), "no token")
+	req.AddCookie(&http.Cookie{Name: "csrf", Value: "t1"})
+	req.Header.Set("X-CSRF-Token", "t2")
+	assert.False(t, s.checkCSRF(req), "wrong token")
+	req.Header.Set("X-CSRF-Token", "t1")
+	assert.True(t, s.checkCSRF(req), "token")
+
+	md := make(http.Header)
+	s.opts.session.sessionMetadata(req, md)
+	assert.Equal(t, "s1", md.Get("session-id"))
+}
+
+func TestSetCookieWriter(t *testing.T) {
+	t.Parallel()
+	rec := httptest.NewRecorder()
+	w := &setCookieWriter{ResponseWriter: rec, cookies: map[string]CookieConfig{
+		"set-session": {Name: "session", MaxAge: time.Hour, Secure: true, HttpOnly: true, SameSite: http.SameSiteStrictMode},
+		"set-csrf":    {Name: "csrf"},
+	}}
+	w.Header().Set("Set-Session", "s1")
+	w.Header().Set("Set-Csrf", "")
+	w.Write([]byte("body"))
+
+	assert.Empty(t, rec.Header().Get("Set-Session"))
+	assert.ElementsMatch(t, []string{
+		"session=s1; Path=/; Max-Age=3600; HttpOnly; Secure; SameSite=Strict",
+		"csrf=; Path=/; Max-Age=0",
+	}, rec.Header()["Set-Cookie"])
+}
@@ -0,0 +1,224 @@
+package grpcwebserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StaticConfig configures static asset serving.
+type StaticConfig struct {
+	// IndexFile is served for directories and as SPA fallback. Defaults to "index.html".
+	IndexFile string
+	// SPAFallback serves IndexFile for unknown paths without file extension,
+	// so client-side routes of a single-page app work on reload.
+	SPAFallback bool
+	// ImmutablePattern matches file names which contain a content hash.
+	// They are cached by browsers forever. Defaults to names like "app.3f2a1b9c.js".
+	ImmutablePattern *regexp.Regexp
+	// MaxAge of other files. Zero means browsers revalidate them on every use.
+	MaxAge time.Duration
+}
+
+var defaultImmutablePattern = regexp.MustCompile(`[.-][0-9a-f]{8,}\.[0-9a-z]+$`)
+
+// precompressed encodings in order of preference.
+var precompressed = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// staticHandler serves files from http.FileSystem.
+type staticHandler struct {
+	root http.FileSystem
+	cfg  StaticConfig
+	next http.Handler
+
+	mu    sync.Mutex
+	etags map[string]staticETag
+}
+
+type staticETag struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// NewStaticHandler returns a handler serving static assets from root, for
+// example http.Dir("./dist") or http.FS(embedded). Not found requests are
+// passed to next or get 404 if next is nil.
+//
+// Files are served with ETag and Last-Modified. If the request accepts it and
+// a precompressed variant exists ("app.js.br", "app.js.gz") it is served
+// instead with the content type of the original file.
+func NewStaticHandler(root http.FileSystem, cfg StaticConfig, next http.Handler) http.Handler {
+	if cfg.IndexFile == "" {
+		cfg.IndexFile = "index.html"
+	}
+	if cfg.ImmutablePattern == nil {
+		cfg.ImmutablePattern = defaultImmutablePattern
+	}
+	if next == nil {
+		next = http.NotFoundHandler()
+	}
+	return &staticHandler{
+		root:  root,
+		cfg:   cfg,
+		next:  next,
+		etags: make(map[string]staticETag),
+	}
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		h.next.ServeHTTP(w, req)
+		return
+	}
+
+	name := path.Clean("/" + req.URL.Path)
+	if strings.HasSuffix(name, "/") {
+		name += h.cfg.IndexFile
+	}
+	if h.serveFile(w, req, name) {
+		return
+	}
+	if h.serveFile(w, req, path.Join(name, h.cfg.IndexFile)) {
+		return
+	}
+	if h.cfg.SPAFallback && path.Ext(name) == "" && h.serveFile(w, req, "/"+h.cfg.IndexFile) {
+		return
+	}
+	h.next.ServeHTTP(w, req)
+}
+
+// serveFile serves the file or its precompressed variant.
+// It returns false if the file does not exist.
+func (h *staticHandler) serveFile(w http.ResponseWriter, req *http.Request, name string) bool {
+	f, fi, ok := h.open(name)
+	if !ok {
+		return false
+	}
+	defer f.Close()
+
+	ctype := mime.TypeByExtension(path.Ext(name))
+	encoding := ""
+	acceptEncoding := req.Header.Get("Accept-Encoding")
+	for _, p := range precompressed {
+		if !acceptsEncoding(acceptEncoding, p.encoding) {
+			continue
+		}
+		if cf, cfi, ok := h.open(name + p.ext); ok {
+			defer cf.Close()
+			f, fi, encoding = cf, cfi, p.encoding
+			break
+		}
+	}
+
+	etag, err := h.etag(name+encoding, f, fi)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return true
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Accept-Encoding")
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", h.cacheControl(name))
+	if ctype != "" {
+		header.Set("Content-Type", ctype)
+	} else if encoding != "" {
+		header.Set("Content-Type", "application/octet-stream")
+	}
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+	}
+	http.ServeContent(w, req, name, fi.ModTime(), f)
+	return true
+}
+
+// open opens a regular file.
+func (h *staticHandler) open(name string) (http.File, os.FileInfo, bool) {
+	f, err := h.root.Open(name)
+	if err != nil {
+		return nil, nil, false
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		f.Close()
+		return nil, nil, false
+	}
+	return f, fi, true
+}
+
+// etag returns strong ETag computed from the file content. It is cached until
+// file size or modification time changes.
+func (h *staticHandler) etag(key string, f http.File, fi os.FileInfo) (string, error) {
+	h.mu.Lock()
+	e, ok := h.etags[key]
+	h.mu.Unlock()
+	if ok && e.size == fi.Size() && e.modTime.Equal(fi.ModTime()) {
+		return e.etag, nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	e = staticETag{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+		etag:    `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`,
+	}
+
+	h.mu.Lock()
+	h.etags[key] = e
+	h.mu.Unlock()
+	return e.etag, nil
+}
+
+func (h *staticHandler) cacheControl(name string) string {
+	base := path.Base(name)
+	switch {
+	case base == h.cfg.IndexFile:
+		return "no-cache"
+	case h.cfg.ImmutablePattern.MatchString(base):
+		return "public, max-age=31536000, immutable"
+	case h.cfg.MaxAge > 0:
+		return "public, max-age=" + strconv.Itoa(int(h.cfg.MaxAge/time.Second))
+	default:
+		return "no-cache"
+	}
+}
+
+// acceptsEncoding reports whether Accept-Encoding header value allows encoding.
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		if strings.TrimSpace(fields[0]) != encoding {
+			continue
+		}
+		for _, param := range fields[1:] {
+			param = strings.Replace(param, " ", "", -1)
+			if param == "q=0" || param == "q=0.0" || param == "q=0.00" || param == "q=0.000" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package grpcwebserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticHandler(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "static")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"index.html":         "<html>app</html>",
+		"app.3f2a1b9c.js":    "console.log(1)",
+		"app.3f2a1b9c.js.gz": "gzipped",
+		"style.css":          "body{}",
+	}
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	h := NewStaticHandler(http.Dir(dir), StaticConfig{SPAFallback: true}, nil)
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, vv := range header {
+			req.Header[k] = vv
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<html>app</html>", rec.Body.String())
+	assert.Equal(t, "no-cache", rec.Header().Get("Cache-Control"))
+
+	rec = get("/users/42", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<html>app</html>", rec.Body.String())
+
+	rec = get("/missing.js", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = get("/app.3f2a1b9c.js", nil)
+	assert.Equal(t, "console.log(1)", rec.Body.String())
+	assert.Equal(t, "public, max-age=31536000, immutable", rec.Header().Get("Cache-Control"))
+	assert.Contains(t, rec.Header().Get("Content-Type"), "javascript")
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+
+	rec = get("/app.3f2a1b9c.js", http.Header{"Accept-Encoding": {"gzip, br;q=0"}})
+	assert.Equal(t, "gzipped", rec.Body.String())
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Contains(t, rec.Header().Get("Content-Type"), "javascript")
+
+	rec = get("/style.css", nil)
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.NotEmpty(t, rec.Header().Get("Last-Modified"))
+
+	rec = get("/style.css", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+}
@@ -0,0 +1,236 @@
+package grpcwebserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// TLSConfig configures TLS for grpc-web server.
+//
+// Certificate, key and client CA files are checked for changes every
+// ReloadInterval and reloaded without restart.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile is a PEM bundle used to verify client certificates.
+	// Client certificates are not requested if it is empty.
+	ClientCAFile string
+	// RequireClientCert rejects clients without a valid certificate.
+	// Otherwise a certificate is verified only if the client sends one.
+	// It requires ClientCAFile.
+	RequireClientCert bool
+
+	// MinVersion defaults to TLS 1.2.
+	MinVersion uint16
+	// CipherSuites defaults to Go defaults.
+	CipherSuites []uint16
+
+	// ReloadInterval defaults to 10 seconds.
+	ReloadInterval time.Duration
+}
+
+const defaultTLSReloadInterval = 10 * time.Second
+
+// ClientCertificate returns the verified client certificate from the context
+// of a gRPC call or an HTTP request served by grpc-web server.
+func ClientCertificate(ctx context.Context) (*x509.Certificate, bool) {
+	if c, ok := ctx.Value(clientCertCtxKey).(*x509.Certificate); ok {
+		return c, true
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil, false
+	}
+	return verifiedCertificate(&info.State)
+}
+
+func verifiedCertificate(state *tls.ConnectionState) (*x509.Certificate, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	return state.VerifiedChains[0][0], true
+}
+
+// withClientCertificate returns the request with the verified client certificate in the context.
+func withClientCertificate(req *http.Request) *http.Request {
+	if c, ok := verifiedCertificate(req.TLS); ok {
+		return req.WithContext(context.WithValue(req.Context(), clientCertCtxKey, c))
+	}
+	return req
+}
+
+// certReloader keeps the current certificate and client CA pool loaded from files.
+type certReloader struct {
+	cfg  TLSConfig
+	base *tls.Config
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newCertReloader(cfg TLSConfig) (*certReloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("grpcwebserver: TLS certificate and key files are required")
+	}
+	if cfg.RequireClientCert && cfg.ClientCAFile == "" {
+		return nil, errors.New("grpcwebserver: client CA file is required to verify client certificates")
+	}
+	if cfg.ReloadInterval == 0 {
+		cfg.ReloadInterval = defaultTLSReloadInterval
+	}
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+
+	r := &certReloader{
+		cfg:      cfg,
+		modTimes: make(map[string]time.Time),
+		done:     make(chan struct{}),
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// config returns TLS config for the listener.
+func (r *certReloader) config(nextProtos []string) *tls.Config {
+	r.base = &tls.Config{
+		MinVersion:     r.cfg.MinVersion,
+		CipherSuites:   r.cfg.CipherSuites,
+		NextProtos:     nextProtos,
+		GetCertificate: r.getCertificate,
+	}
+	if r.cfg.ClientCAFile != "" {
+		r.base.ClientAuth = tls.VerifyClientCertIfGiven
+		if r.cfg.RequireClientCert {
+			r.base.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	c := r.base.Clone()
+	c.GetConfigForClient = r.getConfigForClient
+	return c
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := r.base.Clone()
+	c.ClientCAs = r.clientCAs
+	return c, nil
+}
+
+// changed reports whether any of the files was modified since the last load.
+func (r *certReloader) changed() bool {
+	for _, name := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		if !fi.ModTime().Equal(r.modTimes[name]) {
+			return true
+		}
+	}
+	return false
+}
+
+// reload loads files if they were changed. It reports whether they were loaded.
+func (r *certReloader) reload() (bool, error) {
+	if !r.changed() {
+		return false, nil
+	}
+
+	modTimes := make(map[string]time.Time)
+	for _, name := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return false, err
+		}
+		modTimes[name] = fi.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return false, err
+	}
+
+	var pool *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return false, err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return false, errors.New("grpcwebserver: no certificates found in " + r.cfg.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	return true, nil
+}
+
+// watch reloads changed files until stop is called.
+func (r *certReloader) watch() {
+	t := time.NewTicker(r.cfg.ReloadInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-t.C:
+			loaded, err := r.reload()
+			if err != nil {
+				zap.L().Error("GrpcWeb TLS reload error, keep previous certificate.", zap.Error(err))
+				continue
+			}
+			if loaded {
+				zap.L().Info("GrpcWeb TLS certificate reloaded.", zap.String("cert", r.cfg.CertFile))
+			}
+		}
+	}
+}
+
+func (r *certReloader) stop() {
+	r.stopOnce.Do(func() {
+		close(r.done)
+	})
+}
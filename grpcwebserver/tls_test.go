@@ -0,0 +1,168 @@
+package grpcwebserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a generated certificate with its key.
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert generates a certificate signed by parent, or a self-signed CA if parent is nil.
+func newTestCert(t *testing.T, cn string, serial int64, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+// writeFile writes b and moves its modification time forward, so reload sees the change.
+func writeFile(t *testing.T, name string, b []byte, modTime time.Time) {
+	t.Helper()
+	require.NoError(t, ioutil.WriteFile(name, b, 0600))
+	require.NoError(t, os.Chtimes(name, modTime, modTime))
+}
+
+func TestServerTLSReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", 1, nil)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	first := newTestCert(t, "server", 2, ca)
+	writeFile(t, certFile, first.certPEM, time.Now())
+	writeFile(t, keyFile, first.keyPEM, time.Now())
+
+	s := startTestServer(t, newTestService(), WithTLS(TLSConfig{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ReloadInterval: 20 * time.Millisecond,
+	}))
+
+	servedSerial := func() int64 {
+		conn, err := tls.Dial("tcp", s.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		require.NoError(t, err)
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+	waitSerial := func(serial int64) {
+		for i := 0; servedSerial() != serial; i++ {
+			require.True(t, i < 100, "certificate %d is not served", serial)
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	assert.Equal(t, int64(2), servedSerial())
+
+	// rotated files are picked up
+	second := newTestCert(t, "server", 3, ca)
+	writeFile(t, certFile, second.certPEM, time.Now().Add(time.Minute))
+	writeFile(t, keyFile, second.keyPEM, time.Now().Add(time.Minute))
+	waitSerial(3)
+
+	// broken files keep the previous certificate
+	writeFile(t, certFile, []byte("broken"), time.Now().Add(2*time.Minute))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int64(3), servedSerial())
+}
+
+func TestServerMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", 1, nil)
+	server := newTestCert(t, "server", 2, ca)
+	client := newTestCert(t, "client", 3, ca)
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	writeFile(t, certFile, server.certPEM, time.Now())
+	writeFile(t, keyFile, server.keyPEM, time.Now())
+	writeFile(t, caFile, ca.certPEM, time.Now())
+
+	// client certificates can't be required without CA
+	_, err := newCertReloader(TLSConfig{CertFile: certFile, KeyFile: keyFile, RequireClientCert: true})
+	assert.Error(t, err)
+
+	svc := newTestService()
+	s := startTestServer(t, svc, WithTLS(TLSConfig{
+		CertFile:          certFile,
+		KeyFile:           keyFile,
+		ClientCAFile:      caFile,
+		RequireClientCert: true,
+	}))
+	url := "https://" + s.Addr().String() + "/test.Service/Echo"
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	// a client without certificate is rejected
+	noCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	require.NoError(t, err)
+	_, err = noCert.Do(req)
+	assert.Error(t, err)
+
+	// the verified client certificate reaches the handler context
+	withCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{client.tlsCertificate()},
+	}}}
+	resp := grpcWebCall(t, withCert, url, &duration.Duration{Seconds: 1})
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "grpc-status: 0")
+	select {
+	case cn := <-svc.certs:
+		assert.Equal(t, "client", cn)
+	case <-time.After(time.Second):
+		t.Fatal("no client certificate in the handler context")
+	}
+}
@@ -0,0 +1,123 @@
+package grpcwebserver
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"strings"
+)
+
+// trailerWriter finds grpc-status in grpc-web responses written by the grpcweb
+// wrapper, which writes trailers into the body. Data frames are skipped,
+// only the trailer frame is buffered.
+type trailerWriter struct {
+	http.ResponseWriter
+	info *requestInfo
+	text bool
+
+	quantum []byte // incomplete base64 quantum for grpc-web-text
+	header  []byte // incomplete frame header
+	skip    int    // bytes left of the current data frame
+	trailer []byte // trailer frame payload
+	need    int    // bytes left of the trailer frame
+}
+
+func newTrailerWriter(w http.ResponseWriter, req *http.Request, info *requestInfo) *trailerWriter {
+	return &trailerWriter{
+		ResponseWriter: w,
+		info:           info,
+		text:           strings.HasPrefix(req.Header.Get("Content-Type"), grpcWebTextContentType),
+	}
+}
+
+func (w *trailerWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	if w.text {
+		w.decode(b[:n])
+	} else {
+		w.parse(b[:n])
+	}
+	return n, err
+}
+
+// decode decodes base64 by 4 byte quanta: grpc-web-text responses may be a
+// concatenation of padded base64 parts.
+func (w *trailerWriter) decode(b []byte) {
+	out := make([]byte, 3)
+	for _, c := range b {
+		w.quantum = append(w.quantum, c)
+		if len(w.quantum) < 4 {
+			continue
+		}
+		n, err := base64.StdEncoding.Decode(out, w.quantum)
+		w.quantum = w.quantum[:0]
+		if err != nil {
+			return
+		}
+		w.parse(out[:n])
+	}
+}
+
+// parse consumes grpc-web frames.
+func (w *trailerWriter) parse(b []byte) {
+	for len(b) > 0 {
+		switch {
+		case w.skip > 0:
+			n := minInt(w.skip, len(b))
+			w.skip -= n
+			b = b[n:]
+
+		case w.need > 0:
+			n := minInt(w.need, len(b))
+			w.trailer = append(w.trailer, b[:n]...)
+			w.need -= n
+			b = b[n:]
+			if w.need == 0 {
+				w.parseTrailer()
+			}
+
+		default:
+			n := minInt(5-len(w.header), len(b))
+			w.header = append(w.header, b[:n]...)
+			b = b[n:]
+			if len(w.header) < 5 {
+				continue
+			}
+			size := int(binary.BigEndian.Uint32(w.header[1:5]))
+			if w.header[0]&(1<<7) != 0 {
+				w.need = size
+				w.trailer = w.trailer[:0]
+			} else {
+				w.skip = size
+			}
+			w.header = w.header[:0]
+		}
+	}
+}
+
+func (w *trailerWriter) parseTrailer() {
+	h, err := parseHeaderBlock(w.trailer)
+	if err != nil {
+		return
+	}
+	if v := h.Get("Grpc-Status"); v != "" {
+		w.info.grpcStatus.Store(v)
+	}
+}
+
+func (w *trailerWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *trailerWriter) CloseNotify() <-chan bool {
+	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
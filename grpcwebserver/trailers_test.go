@@ -0,0 +1,38 @@
+package grpcwebserver
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrailerWriter(t *testing.T) {
+	t.Parallel()
+
+	frame := func(flag byte, b string) []byte {
+		return append([]byte{flag, 0, 0, 0, byte(len(b))}, b...)
+	}
+	var body []byte
+	body = append(body, frame(0, "message")...)
+	body = append(body, frame(1<<7, "grpc-status: 5\r\ngrpc-message: not found\r\n")...)
+
+	for _, contentType := range []string{grpcWebContentType, grpcWebTextContentType} {
+		req := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+		req.Header.Set("Content-Type", contentType)
+		_, info := (&Server{opts: newOptions(nil)}).bridgeRequest(httptest.NewRecorder(), req)
+		w := newTrailerWriter(httptest.NewRecorder(), req, info)
+
+		b := body
+		if contentType == grpcWebTextContentType {
+			// padded base64 parts as written on every flush
+			b = []byte(base64.StdEncoding.EncodeToString(body[:3]) + base64.StdEncoding.EncodeToString(body[3:]))
+		}
+		for i := range b {
+			w.Write(b[i : i+1])
+		}
+		assert.Equal(t, "5", info.grpcStatus.Load(), contentType)
+	}
+}
@@ -0,0 +1,348 @@
+package grpcwebserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// JSONMarshaler encodes proto messages as JSON. *jsonpb.Marshaler implements it.
+type JSONMarshaler interface {
+	Marshal(w io.Writer, pb proto.Message) error
+}
+
+// JSONUnmarshaler decodes JSON into proto messages. *jsonpb.Unmarshaler implements it.
+type JSONUnmarshaler interface {
+	Unmarshal(r io.Reader, pb proto.Message) error
+}
+
+const (
+	jsonContentType   = "application/json"
+	ndjsonContentType = "application/x-ndjson"
+
+	compressedFlag = 1 // first byte of gRPC message prefix
+)
+
+// jsonMethod is a gRPC method exposed as JSON endpoint.
+type jsonMethod struct {
+	in            reflect.Type
+	out           reflect.Type
+	serverStreams bool
+}
+
+// jsonTranscoder serves registered unary and server streaming methods as
+// `POST /package.Service/Method` with JSON request and response bodies.
+type jsonTranscoder struct {
+	marshaler   JSONMarshaler
+	unmarshaler JSONUnmarshaler
+
+	once    sync.Once
+	methods map[string]*jsonMethod
+}
+
+func isJSONRequest(req *http.Request) bool {
+	return req.Method == http.MethodPost && strings.HasPrefix(req.Header.Get("Content-Type"), jsonContentType)
+}
+
+// isJSONPreflight reports whether req is a CORS preflight for a transcoded method.
+func (s *Server) isJSONPreflight(req *http.Request) bool {
+	return s.opts.json != nil && req.Method == http.MethodOptions &&
+		req.Header.Get("Access-Control-Request-Method") != "" && s.opts.json.method(s, req.URL.Path) != nil
+}
+
+// method returns the method for the request path.
+// Methods are looked up on first call, so all services must be registered before serving.
+func (t *jsonTranscoder) method(s *Server, path string) *jsonMethod {
+	t.once.Do(func() {
+		t.methods = make(map[string]*jsonMethod)
+		for name, info := range s.grpc.GetServiceInfo() {
+			file, _ := info.Metadata.(string)
+			descs, err := serviceMethods(file, name)
+			if err != nil {
+				zap.L().Warn("GrpcWeb JSON transcoding is not available for service.", zap.String("service", name), zap.Error(err))
+				continue
+			}
+			for _, m := range info.Methods {
+				d, ok := descs[m.Name]
+				if !ok || d.GetClientStreaming() {
+					continue
+				}
+				in, out := proto.MessageType(messageType(d.GetInputType())), proto.MessageType(messageType(d.GetOutputType()))
+				if in == nil || out == nil {
+					zap.L().Warn("GrpcWeb JSON transcoding: message types are not registered.", zap.String("method", m.Name))
+					continue
+				}
+				t.methods["/"+name+"/"+m.Name] = &jsonMethod{
+					in:            in.Elem(),
+					out:           out.Elem(),
+					serverStreams: d.GetServerStreaming(),
+				}
+			}
+		}
+	})
+	return t.methods[path]
+}
+
+// serve calls the method through the gRPC server, so the server interceptors are applied.
+func (t *jsonTranscoder) serve(s *Server, w http.ResponseWriter, req *http.Request, m *jsonMethod) {
+	in := reflect.New(m.in).Interface().(proto.Message)
+	if err := t.unmarshaler.Unmarshal(req.Body, in); err != nil {
+		t.writeError(w, req, status.New(codes.InvalidArgument, err.Error()))
+		return
+	}
+	b, err := proto.Marshal(in)
+	if err != nil {
+		t.writeError(w, req, status.New(codes.InvalidArgument, err.Error()))
+		return
+	}
+
+	body := make([]byte, 5+len(b))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(b)))
+	copy(body[5:], b)
+
+	grpcReq := req.WithContext(req.Context())
+	grpcReq.ProtoMajor = 2
+	grpcReq.ProtoMinor = 0
+	grpcReq.Header = cloneHeader(req.Header)
+	grpcReq.Header.Set("Content-Type", grpcContentType+"+proto")
+	grpcReq.Header.Del("Grpc-Encoding")
+	grpcReq.Header.Del("Grpc-Accept-Encoding")
+	grpcReq.Header.Del("Content-Length")
+	grpcReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	grpcReq.ContentLength = -1
+
+	var (
+		resp  []byte
+		lines int
+	)
+	rw := &grpcFrameWriter{header: make(http.Header)}
+	rw.onMessage = func(msg []byte) {
+		if !m.serverStreams {
+			resp = msg
+			return
+		}
+		if lines == 0 {
+			copyResponseHeaders(w.Header(), rw.header)
+			w.Header().Set("Content-Type", ndjsonContentType)
+			w.WriteHeader(http.StatusOK)
+		}
+		lines++
+		if err := t.writeMessage(w, m, msg); err != nil {
+			zap.L().Warn("GrpcWeb JSON transcoding: failed to write message.", zap.Error(err))
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	s.grpc.ServeHTTP(rw, grpcReq)
+
+	st := statusFromHeader(rw.header)
+	if rw.err != nil {
+		st = status.New(codes.Internal, rw.err.Error())
+	}
+	setGrpcStatus(req.Context(), st.Code())
+	if lines > 0 {
+		if st.Code() != codes.OK {
+			t.writeStreamError(w, st)
+		}
+		return
+	}
+	copyResponseHeaders(w.Header(), rw.header)
+	if st.Code() != codes.OK {
+		t.writeError(w, req, st)
+		return
+	}
+	if resp == nil {
+		if m.serverStreams {
+			w.Header().Set("Content-Type", ndjsonContentType)
+			w.WriteHeader(http.StatusOK)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	if err := t.writeMessage(w, m, resp); err != nil {
+		zap.L().Warn("GrpcWeb JSON transcoding: failed to write message.", zap.Error(err))
+	}
+}
+
+func (t *jsonTranscoder) writeMessage(w io.Writer, m *jsonMethod, b []byte) error {
+	out := reflect.New(m.out).Interface().(proto.Message)
+	if err := proto.Unmarshal(b, out); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := t.marshaler.Marshal(&buf, out); err != nil {
+		return err
+	}
+	if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeStreamError writes `{"error": status}` line after streamed messages.
+func (t *jsonTranscoder) writeStreamError(w io.Writer, st *status.Status) {
+	var buf bytes.Buffer
+	if err := t.marshaler.Marshal(&buf, st.Proto()); err != nil {
+		zap.L().Warn("GrpcWeb JSON transcoding: failed to write error.", zap.Error(err))
+		return
+	}
+	fmt.Fprintf(w, "{\"error\":%s}\n", bytes.TrimSpace(buf.Bytes()))
+}
+
+func (t *jsonTranscoder) writeError(w http.ResponseWriter, req *http.Request, st *status.Status) {
+	setGrpcStatus(req.Context(), st.Code())
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(httpStatusFromCode(st.Code()))
+	t.marshaler.Marshal(w, st.Proto())
+}
+
+// errCompressedFrame is returned for compressed response messages. Requests
+// are sent without grpc-accept-encoding, so a compressed message is a server
+// misconfiguration.
+var errCompressedFrame = errors.New("compressed gRPC message is not supported")
+
+// grpcFrameWriter is http.ResponseWriter which parses length-prefixed gRPC messages.
+type grpcFrameWriter struct {
+	header    http.Header
+	buf       bytes.Buffer
+	onMessage func(b []byte)
+	err       error
+}
+
+func (w *grpcFrameWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *grpcFrameWriter) WriteHeader(int) {}
+
+func (w *grpcFrameWriter) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf.Write(b)
+	for w.buf.Len() >= 5 {
+		if w.buf.Bytes()[0]&compressedFlag != 0 {
+			w.err = errCompressedFrame
+			return 0, w.err
+		}
+		n := int(binary.BigEndian.Uint32(w.buf.Bytes()[1:5]))
+		if w.buf.Len() < 5+n {
+			break
+		}
+		frame := w.buf.Next(5 + n)
+		msg := make([]byte, n)
+		copy(msg, frame[5:])
+		w.onMessage(msg)
+	}
+	return len(b), nil
+}
+
+func (w *grpcFrameWriter) Flush() {}
+
+// statusFromHeader returns gRPC status from response headers or trailers.
+func statusFromHeader(h http.Header) *status.Status {
+	get := func(k string) string {
+		if v := h.Get(k); v != "" {
+			return v
+		}
+		return h.Get(http2.TrailerPrefix + k)
+	}
+
+	if b := get("Grpc-Status-Details-Bin"); b != "" {
+		if data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(b, "=")); err == nil {
+			p := &spb.Status{}
+			if proto.Unmarshal(data, p) == nil {
+				return status.FromProto(p)
+			}
+		}
+	}
+
+	code, err := strconv.Atoi(get("Grpc-Status"))
+	if err != nil {
+		return status.New(codes.Unknown, "missing grpc-status")
+	}
+	msg, err := url.PathUnescape(get("Grpc-Message"))
+	if err != nil {
+		msg = get("Grpc-Message")
+	}
+	return status.New(codes.Code(code), msg)
+}
+
+// copyResponseHeaders copies gRPC response metadata to HTTP response headers.
+func copyResponseHeaders(dst, src http.Header) {
+	for k, vv := range src {
+		if k == "Content-Type" || k == "Date" || k == "Trailer" || strings.HasPrefix(k, "Grpc-") || strings.HasPrefix(k, http2.TrailerPrefix) {
+			continue
+		}
+		dst[k] = vv
+	}
+}
+
+func cloneHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for k, vv := range h {
+		c[k] = append([]string(nil), vv...)
+	}
+	return c
+}
+
+// httpStatusFromCode maps gRPC status codes to HTTP status codes.
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // client closed request
+	case codes.Unknown:
+		return http.StatusInternalServerError
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.Aborted:
+		return http.StatusConflict
+	case codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Internal:
+		return http.StatusInternalServerError
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DataLoss:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusInternalServerError
+	}
+}
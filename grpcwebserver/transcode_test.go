@@ -0,0 +1,119 @@
+package grpcwebserver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postJSON(t *testing.T, s *Server, method, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post("http://"+s.Addr().String()+method, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	return resp
+}
+
+func TestJSONTranscodingUnary(t *testing.T) {
+	s := startTestServer(t, newTestService(), WithJSONTranscoding(nil, nil))
+
+	resp := postJSON(t, s, "/test.Service/Echo", `"1.500s"`)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `"1.500s"`, strings.TrimSpace(string(body)))
+}
+
+func TestJSONTranscodingServerStreaming(t *testing.T) {
+	svc := newTestService()
+	close(svc.release)
+	s := startTestServer(t, svc, WithJSONTranscoding(nil, nil))
+
+	resp := postJSON(t, s, "/test.Service/Wait", `"2s"`)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	var lines []string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	require.NoError(t, sc.Err())
+	assert.Equal(t, []string{`"2s"`}, lines)
+}
+
+func TestJSONTranscodingErrors(t *testing.T) {
+	s := startTestServer(t, newTestService(), WithJSONTranscoding(nil, nil))
+
+	for _, tc := range []struct {
+		name, method, body string
+		code               int
+		contains           string
+	}{
+		{"status error", "/test.Service/Echo", `"-1s"`, http.StatusBadRequest, "negative duration"},
+		{"malformed body", "/test.Service/Echo", `{`, http.StatusBadRequest, `"code":3`},
+		{"unknown method", "/test.Service/Missing", `"1s"`, http.StatusNotFound, ""},
+		{"unknown service", "/other.Service/Echo", `"1s"`, http.StatusNotFound, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := postJSON(t, s, tc.method, tc.body)
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tc.code, resp.StatusCode)
+			assert.Contains(t, string(body), tc.contains)
+		})
+	}
+}
+
+func TestJSONTranscodingPreflight(t *testing.T) {
+	s := startTestServer(t, newTestService(), WithJSONTranscoding(nil, nil), WithCORS(CORSPolicy{
+		AllowedOrigins: []string{"https://app.example.com"},
+	}))
+
+	preflight := func(method, origin string) *http.Response {
+		req, err := http.NewRequest(http.MethodOptions, "http://"+s.Addr().String()+method, nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "content-type")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := preflight("/test.Service/Echo", "https://app.example.com")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, resp.Header.Get("Access-Control-Allow-Headers"), "content-type")
+
+	assert.Equal(t, http.StatusForbidden, preflight("/test.Service/Echo", "https://evil.example.com").StatusCode)
+	assert.Equal(t, http.StatusNotFound, preflight("/test.Service/Missing", "https://app.example.com").StatusCode)
+}
+
+func TestGrpcFrameWriterCompressed(t *testing.T) {
+	var msgs []string
+	w := &grpcFrameWriter{header: make(http.Header), onMessage: func(b []byte) { msgs = append(msgs, string(b)) }}
+
+	frame := func(flag byte, msg string) []byte {
+		b := make([]byte, 5, 5+len(msg))
+		b[0] = flag
+		binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+		return append(b, msg...)
+	}
+	_, err := w.Write(frame(0, "plain"))
+	require.NoError(t, err)
+	_, err = w.Write(frame(compressedFlag, "gzip"))
+	assert.Equal(t, errCompressedFrame, err)
+	_, err = w.Write(frame(0, "after"))
+	assert.Equal(t, errCompressedFrame, err)
+	assert.Equal(t, []string{"plain"}, msgs)
+}
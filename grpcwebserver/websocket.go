@@ -0,0 +1,431 @@
+package grpcwebserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	grpcContentType        = "application/grpc"
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+
+	websocketProtocol = "grpc-websockets"
+
+	// websocketCloseTimeout limits how long sending a close frame may take.
+	websocketCloseTimeout = time.Second
+)
+
+// isWebsocketRequest reports whether req is a grpc-web websocket upgrade.
+func isWebsocketRequest(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Upgrade"), "websocket") &&
+		req.Header.Get("Sec-Websocket-Protocol") == websocketProtocol
+}
+
+// wsStream bridges a single gRPC call over a websocket connection.
+//
+// grpcweb.WrappedGrpcServer.HandleGrpcWebsocketRequest is not used: in the
+// vendored version it accepts any origin, replaces request headers with the
+// ones from the first message, and does not expose the connection, so streams
+// can't be tracked for shutdown, limited or counted.
+//
+// The framing follows grpcweb's websocket transport: the first client message
+// carries request headers, each following binary message is prefixed with a
+// control byte (0 for data, 1 for end of client send). The server sends
+// headers and trailers as grpc-web frames with the MSB flag set.
+type wsStream struct {
+	conn   *websocket.Conn
+	cancel context.CancelFunc
+
+	headers        http.Header
+	flushedHeaders http.Header
+	wroteHeader    bool
+
+	remaining  []byte
+	finishOnce sync.Once
+	goingAway  func() bool
+	info       *requestInfo
+	onLimit    func(reason string)
+
+	eof          bool
+	lastActivity atomic.Int64 // unix nanoseconds
+	lastPong     atomic.Int64 // unix nanoseconds
+
+	mu       sync.Mutex
+	override *status.Status // status set when the stream is closed by limits
+}
+
+func (s *Server) serveWebsocket(w http.ResponseWriter, req *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		zap.L().Warn("GrpcWeb websocket upgrade error.", zap.Error(err))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	ip := remoteIP(req)
+	stream := &wsStream{
+		conn:      conn,
+		cancel:    cancel,
+		headers:   make(http.Header),
+		goingAway: s.hijacked.isDraining,
+		info:      getRequestInfo(req.Context()),
+		onLimit:   func(reason string) { s.websocketLimit(reason, ip, req.URL.Path) },
+	}
+	if stream.info != nil {
+		ip = stream.info.remoteIP
+	}
+	if !s.hijacked.add(stream) {
+		setStatus(stream.headers, codes.Unavailable, "server is shutting down")
+		stream.finish()
+		return
+	}
+	defer s.hijacked.remove(stream)
+
+	limits := s.opts.websocketLimits
+	if reason := s.streams.acquire(limits, ip); reason != "" {
+		stream.onLimit(reason)
+		setStatus(stream.headers, codes.ResourceExhausted, "too many websocket streams")
+		stream.finish()
+		return
+	}
+	defer s.streams.release(ip)
+
+	if !s.opts.methods.allowed(req.URL.Path) {
+		code, msg := s.opts.methods.status(req.URL.Path)
+		setStatus(stream.headers, code, msg)
+		stream.finish()
+		return
+	}
+	if s.opts.metrics != nil {
+		s.opts.metrics.websockets.Inc()
+		defer s.opts.metrics.websockets.Dec()
+	}
+
+	if limits.MaxMessageSize > 0 {
+		conn.SetReadLimit(limits.MaxMessageSize)
+	}
+	now := time.Now().UnixNano()
+	stream.lastActivity.Store(now)
+	stream.lastPong.Store(now)
+	conn.SetPongHandler(func(string) error {
+		stream.lastPong.Store(time.Now().UnixNano())
+		return nil
+	})
+	if limits.IdleTimeout > 0 || limits.PingInterval > 0 || limits.MaxLifetime > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go stream.supervise(limits, done, stream.onLimit)
+	}
+
+	messageType, b, err := conn.ReadMessage()
+	stream.countIn(len(b))
+	if err == websocket.ErrReadLimit {
+		stream.onLimit(limitMessageSize)
+		conn.Close()
+		return
+	}
+	if err != nil {
+		zap.L().Warn("GrpcWeb websocket failed to read headers.", zap.Error(err))
+		conn.Close()
+		return
+	}
+	if messageType != websocket.BinaryMessage {
+		zap.L().Warn("GrpcWeb websocket first message is not binary.")
+		conn.Close()
+		return
+	}
+	headers, err := parseHeaderBlock(b)
+	if err != nil {
+		zap.L().Warn("GrpcWeb websocket failed to parse headers.", zap.Error(err))
+		conn.Close()
+		return
+	}
+
+	contentType := headers.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, grpcWebTextContentType):
+		setStatus(stream.headers, codes.Unimplemented, "grpc-web-text is not supported over websockets")
+		stream.finish()
+		return
+	case !strings.HasPrefix(contentType, grpcWebContentType):
+		setStatus(stream.headers, codes.InvalidArgument, "invalid content-type")
+		stream.finish()
+		return
+	}
+	headers.Set("Content-Type", strings.Replace(contentType, grpcWebContentType, grpcContentType, 1))
+	headers.Del("Content-Length")
+	if stream.info != nil {
+		for k, vv := range stream.info.metadata {
+			headers[k] = vv
+		}
+	}
+
+	grpcReq := req.WithContext(ctx)
+	grpcReq.Method = http.MethodPost
+	grpcReq.ProtoMajor = 2
+	grpcReq.ProtoMinor = 0
+	grpcReq.Header = headers
+	grpcReq.Body = stream
+	grpcReq.ContentLength = -1
+
+	s.grpc.ServeHTTP(stream, grpcReq)
+	stream.finish()
+}
+
+// parseHeaderBlock parses headers sent in websocket messages and grpc-web frames.
+func parseHeaderBlock(b []byte) (http.Header, error) {
+	r := textproto.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(b), strings.NewReader("\r\n"))))
+	h, err := r.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	return http.Header(h), nil
+}
+
+// Header implements http.ResponseWriter.
+func (s *wsStream) Header() http.Header {
+	return s.headers
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (s *wsStream) WriteHeader(code int) {
+	if s.wroteHeader {
+		return
+	}
+	s.writeHeaders(false)
+}
+
+// writeHeaders sends response headers. Status headers are skipped for
+// trailers-only responses so they are sent as trailers.
+func (s *wsStream) writeHeaders(skipStatus bool) {
+	s.wroteHeader = true
+	s.flushedHeaders = make(http.Header, len(s.headers))
+	for k, vv := range s.headers {
+		if k == "Trailer" || strings.HasPrefix(k, http2.TrailerPrefix) || (skipStatus && isStatusHeader(k)) {
+			continue
+		}
+		s.flushedHeaders[k] = vv
+	}
+
+	h := make(http.Header, len(s.flushedHeaders))
+	for k, vv := range s.flushedHeaders {
+		h[k] = vv
+	}
+	if ct := h.Get("Content-Type"); ct != "" {
+		h.Set("Content-Type", strings.Replace(ct, grpcContentType, grpcWebContentType, 1))
+	}
+	s.writeFrame(h)
+}
+
+// Write implements http.ResponseWriter.
+func (s *wsStream) Write(b []byte) (int, error) {
+	if !s.wroteHeader {
+		s.WriteHeader(http.StatusOK)
+	}
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	s.countOut(len(b))
+	s.lastActivity.Store(time.Now().UnixNano())
+	return len(b), nil
+}
+
+// Flush implements http.Flusher. Every Write is sent immediately.
+func (s *wsStream) Flush() {}
+
+// Read implements io.Reader for the request body.
+func (s *wsStream) Read(p []byte) (int, error) {
+	for len(s.remaining) == 0 {
+		if s.eof {
+			return 0, io.EOF
+		}
+		messageType, b, err := s.conn.ReadMessage()
+		s.countIn(len(b))
+		if err == websocket.ErrReadLimit {
+			s.onLimit(limitMessageSize)
+			s.expire(codes.ResourceExhausted, "message is too large")
+			return 0, io.EOF
+		}
+		if err != nil {
+			// the client has gone away
+			s.cancel()
+			return 0, io.EOF
+		}
+		s.lastActivity.Store(time.Now().UnixNano())
+		if messageType != websocket.BinaryMessage || len(b) == 0 {
+			continue
+		}
+		if b[0] == 1 && len(b) == 1 {
+			s.eof = true
+			go s.discardReads()
+			return 0, io.EOF
+		}
+		s.remaining = b[1:]
+	}
+
+	n := copy(p, s.remaining)
+	s.remaining = s.remaining[n:]
+	return n, nil
+}
+
+// discardReads keeps reading after the client finished sending, so pongs and
+// close frames are processed and a gone client cancels the call.
+func (s *wsStream) discardReads() {
+	for {
+		if _, _, err := s.conn.ReadMessage(); err != nil {
+			s.cancel()
+			return
+		}
+	}
+}
+
+// ping sends a ping, the pong handler records the response.
+func (s *wsStream) ping() {
+	deadline := time.Now().Add(websocketCloseTimeout)
+	if err := s.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+		zap.L().Debug("GrpcWeb websocket ping error.", zap.Error(err))
+	}
+}
+
+// expire aborts the stream, finish sends the given status to the client.
+func (s *wsStream) expire(code codes.Code, msg string) {
+	s.mu.Lock()
+	if s.override == nil {
+		s.override = status.New(code, msg)
+	}
+	s.mu.Unlock()
+	s.abort()
+}
+
+// abort cancels the call and interrupts pending reads.
+// Trailers and close frame are still written by finish.
+func (s *wsStream) abort() {
+	s.cancel()
+	s.conn.UnderlyingConn().SetReadDeadline(time.Now())
+}
+
+// close cancels the call and closes the connection with "going away" status
+// without waiting for the handler, it is called when shutdown times out.
+func (s *wsStream) close() {
+	s.mu.Lock()
+	if s.override == nil {
+		s.override = status.New(codes.Unavailable, "server is shutting down")
+	}
+	s.mu.Unlock()
+	s.cancel()
+	deadline := time.Now().Add(websocketCloseTimeout)
+	s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), deadline)
+	s.conn.Close()
+}
+
+// Close implements io.Closer for the request body. gRPC closes the body once
+// the call is done, so trailers are written here.
+func (s *wsStream) Close() error {
+	s.finish()
+	return nil
+}
+
+// finish writes trailers and closes the websocket connection.
+func (s *wsStream) finish() {
+	s.finishOnce.Do(func() {
+		s.mu.Lock()
+		override := s.override
+		s.mu.Unlock()
+		if override != nil {
+			s.headers.Del(http2.TrailerPrefix + "Grpc-Status")
+			s.headers.Del(http2.TrailerPrefix + "Grpc-Message")
+			s.headers.Del("Grpc-Status-Details-Bin")
+			setStatus(s.headers, override.Code(), override.Message())
+		}
+		if s.headers.Get("Grpc-Status") == "" && s.headers.Get(http2.TrailerPrefix+"Grpc-Status") == "" {
+			setStatus(s.headers, codes.Unavailable, "stream closed by server")
+		}
+		if !s.wroteHeader {
+			s.writeHeaders(true)
+		}
+
+		trailers := make(http.Header)
+		for k, vv := range s.headers {
+			if k == "Trailer" {
+				continue
+			}
+			if _, ok := s.flushedHeaders[k]; ok {
+				continue
+			}
+			k = strings.ToLower(strings.TrimPrefix(k, http2.TrailerPrefix))
+			trailers[k] = vv
+		}
+		s.writeFrame(trailers)
+		if s.info != nil {
+			if vv := trailers["grpc-status"]; len(vv) > 0 {
+				s.info.grpcStatus.Store(vv[0])
+			}
+		}
+
+		code := websocket.CloseNormalClosure
+		if s.goingAway() || override != nil {
+			code = websocket.CloseGoingAway
+		}
+		deadline := time.Now().Add(websocketCloseTimeout)
+		s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), deadline)
+		s.conn.Close()
+	})
+}
+
+// writeFrame writes headers as a grpc-web header frame.
+func (s *wsStream) writeFrame(h http.Header) {
+	var buf bytes.Buffer
+	buf.Write([]byte{1 << 7, 0, 0, 0, 0}) // MSB=1 indicates this is a header frame
+	h.Write(&buf)
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b[1:5], uint32(len(b)-5))
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		zap.L().Debug("GrpcWeb websocket write error.", zap.Error(err))
+		return
+	}
+	s.countOut(len(b))
+}
+
+func (s *wsStream) countIn(n int) {
+	if s.info != nil {
+		s.info.bytesIn.Add(int64(n))
+	}
+}
+
+func (s *wsStream) countOut(n int) {
+	if s.info != nil {
+		s.info.bytesOut.Add(int64(n))
+	}
+}
+
+func setStatus(h http.Header, code codes.Code, msg string) {
+	h.Set("Grpc-Status", strconv.Itoa(int(code)))
+	h.Set("Grpc-Message", msg)
+}
+
+func isStatusHeader(k string) bool {
+	switch k {
+	case "Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,556 @@
+package grpcwebtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	binaryContentType = "application/grpc-web+proto"
+	textContentType   = "application/grpc-web-text+proto"
+)
+
+// ClientOption configures grpc-web client.
+type ClientOption func(c *Client)
+
+// WithTextFormat uses grpc-web-text (base64) framing.
+func WithTextFormat() ClientOption {
+	return func(c *Client) {
+		c.text = true
+	}
+}
+
+// WithWebsockets makes calls over websockets, which is required for client streaming.
+func WithWebsockets() ClientOption {
+	return func(c *Client) {
+		c.websockets = true
+	}
+}
+
+// WithHTTPClient sets HTTP client for grpc-web requests.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithHeader adds HTTP headers to every request and websocket upgrade,
+// e.g. Origin or Cookie.
+func WithHeader(h http.Header) ClientOption {
+	return func(c *Client) {
+		for k, vv := range h {
+			c.header[k] = append(c.header[k], vv...)
+		}
+	}
+}
+
+// Client is a grpc-web client.
+//
+// It has Invoke and NewStream methods with the signatures of *grpc.ClientConn,
+// e.g. c.Invoke(ctx, "/pkg.Service/Method", in, out).
+type Client struct {
+	baseURL    string
+	http       *http.Client
+	header     http.Header
+	text       bool
+	websockets bool
+}
+
+// NewClient returns a client calling server at baseURL, e.g. "http://127.0.0.1:8080".
+func NewClient(baseURL string, opts ...ClientOption) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    http.DefaultClient,
+		header:  make(http.Header),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Invoke performs a unary call.
+func (c *Client) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	s, err := c.NewStream(ctx, &grpc.StreamDesc{}, method, opts...)
+	if err != nil {
+		return err
+	}
+	if err := s.SendMsg(args); err != nil {
+		return err
+	}
+	if err := s.CloseSend(); err != nil {
+		return err
+	}
+	if err := s.RecvMsg(reply); err != nil {
+		return err
+	}
+	if err := s.RecvMsg(reply); err != io.EOF {
+		if err == nil {
+			return status.Error(codes.Internal, "grpcwebtest: unexpected second message")
+		}
+		return err
+	}
+	return nil
+}
+
+// NewStream starts a streaming call. Client streaming requires WithWebsockets.
+func (c *Client) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &clientStream{
+		ctx:    ctx,
+		cancel: cancel,
+		c:      c,
+		method: method,
+		opts:   opts,
+	}
+	if !c.websockets {
+		if desc.ClientStreams {
+			cancel()
+			return nil, status.Error(codes.Unimplemented, "grpcwebtest: client streaming requires websockets")
+		}
+		return s, nil
+	}
+	if err := s.dial(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return s, nil
+}
+
+// requestHeader returns headers of the call: client headers, outgoing metadata and timeout.
+func (c *Client) requestHeader(ctx context.Context) http.Header {
+	h := make(http.Header)
+	for k, vv := range c.header {
+		h[k] = append([]string{}, vv...)
+	}
+	contentType := binaryContentType
+	if c.text && !c.websockets {
+		contentType = textContentType
+	}
+	h.Set("Content-Type", contentType)
+	h.Set("Accept", contentType)
+	h.Set("X-Grpc-Web", "1")
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	for k, vv := range md {
+		for _, v := range vv {
+			if strings.HasSuffix(k, "-bin") {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			h.Add(k, v)
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		h.Set("Grpc-Timeout", encodeTimeout(time.Until(deadline)))
+	}
+	return h
+}
+
+func encodeTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "1n"
+	}
+	if ms := int64((d + time.Millisecond - 1) / time.Millisecond); ms < 1e8 {
+		return strconv.FormatInt(ms, 10) + "m"
+	}
+	return strconv.FormatInt(int64(d/time.Second), 10) + "S"
+}
+
+// clientStream is grpc.ClientStream over grpc-web HTTP request or websocket.
+// It is not safe to call Header and RecvMsg concurrently.
+type clientStream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	c      *Client
+	method string
+	opts   []grpc.CallOption
+
+	// HTTP request body, sent on CloseSend
+	body    bytes.Buffer
+	started bool
+	resp    *http.Response
+
+	conn *websocket.Conn
+
+	frames     *frameReader
+	header     metadata.MD
+	gotHeader  bool
+	trailer    metadata.MD
+	err        error // final status, io.EOF for OK
+	readErrSet bool
+}
+
+func (s *clientStream) dial() error {
+	u, err := url.Parse(s.c.baseURL + s.method)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+
+	h := make(http.Header)
+	for k, vv := range s.c.header {
+		h[k] = vv
+	}
+	d := websocket.Dialer{Subprotocols: []string{"grpc-websockets"}}
+	conn, resp, err := d.DialContext(s.ctx, u.String(), h)
+	if err != nil {
+		if resp != nil {
+			return httpError(resp)
+		}
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	s.conn = conn
+	s.frames = &frameReader{r: &wsReader{conn: conn}}
+	go func() {
+		<-s.ctx.Done()
+		conn.Close()
+	}()
+
+	var buf bytes.Buffer
+	s.c.requestHeader(s.ctx).Write(&buf)
+	return s.wsWrite(buf.Bytes())
+}
+
+func (s *clientStream) wsWrite(b []byte) error {
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return nil
+}
+
+// Header implements grpc.ClientStream.
+func (s *clientStream) Header() (metadata.MD, error) {
+	if err := s.readHeader(); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return s.header, nil
+}
+
+// Trailer implements grpc.ClientStream.
+func (s *clientStream) Trailer() metadata.MD {
+	return s.trailer
+}
+
+// Context implements grpc.ClientStream.
+func (s *clientStream) Context() context.Context {
+	return s.ctx
+}
+
+// SendMsg implements grpc.ClientStream.
+func (s *clientStream) SendMsg(m interface{}) error {
+	b, err := proto.Marshal(m.(proto.Message))
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	frame := make([]byte, 5+len(b))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(b)))
+	copy(frame[5:], b)
+
+	if s.conn != nil {
+		return s.wsWrite(append([]byte{0}, frame...))
+	}
+	if s.started {
+		return status.Error(codes.Internal, "grpcwebtest: SendMsg after CloseSend")
+	}
+	s.body.Write(frame)
+	return nil
+}
+
+// CloseSend implements grpc.ClientStream.
+func (s *clientStream) CloseSend() error {
+	if s.conn != nil {
+		return s.wsWrite([]byte{1})
+	}
+	return s.start()
+}
+
+// start sends the grpc-web HTTP request.
+func (s *clientStream) start() error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+
+	body := s.body.Bytes()
+	if s.c.text {
+		body = []byte(base64.StdEncoding.EncodeToString(body))
+	}
+	req, err := http.NewRequest(http.MethodPost, s.c.baseURL+s.method, bytes.NewReader(body))
+	if err != nil {
+		return s.fail(status.Error(codes.Internal, err.Error()))
+	}
+	req = req.WithContext(s.ctx)
+	req.Header = s.c.requestHeader(s.ctx)
+
+	resp, err := s.c.http.Do(req)
+	if err != nil {
+		return s.fail(status.FromContextError(err).Err())
+	}
+	s.resp = resp
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return s.fail(httpError(resp))
+	}
+
+	var r io.Reader = resp.Body
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/grpc-web-text") {
+		r = &base64Reader{r: resp.Body}
+	}
+	s.frames = &frameReader{r: r}
+
+	s.header = headerMetadata(resp.Header)
+	s.gotHeader = true
+	if resp.Header.Get("Grpc-Status") != "" {
+		// trailers-only response
+		resp.Body.Close()
+		s.trailer = s.header
+		return s.fail(statusFromMetadata(s.header))
+	}
+	return nil
+}
+
+// fail sets the final status of the call and returns it.
+func (s *clientStream) fail(err error) error {
+	if !s.readErrSet {
+		s.readErrSet = true
+		s.err = err
+		s.applyCallOptions()
+		if s.resp != nil {
+			s.resp.Body.Close()
+		}
+		s.cancel()
+	}
+	return err
+}
+
+func (s *clientStream) applyCallOptions() {
+	for _, opt := range s.opts {
+		switch o := opt.(type) {
+		case grpc.HeaderCallOption:
+			*o.HeaderAddr = s.header
+		case grpc.TrailerCallOption:
+			*o.TrailerAddr = s.trailer
+		}
+	}
+}
+
+func (s *clientStream) readHeader() error {
+	if s.conn == nil {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	if s.gotHeader {
+		return nil
+	}
+	if s.readErrSet {
+		return s.err
+	}
+	flag, b, err := s.frames.next()
+	if err != nil {
+		return s.fail(s.readError(err))
+	}
+	if flag&(1<<7) == 0 {
+		return s.fail(status.Error(codes.Internal, "grpcwebtest: message before headers"))
+	}
+	s.gotHeader = true
+	s.header = headerMetadata(parseHeaderBlock(b))
+	return nil
+}
+
+// RecvMsg implements grpc.ClientStream. It returns io.EOF when the call is finished with OK status.
+func (s *clientStream) RecvMsg(m interface{}) error {
+	if err := s.readHeader(); err != nil {
+		return err
+	}
+	if s.readErrSet {
+		return s.err
+	}
+
+	flag, b, err := s.frames.next()
+	if err != nil {
+		return s.fail(s.readError(err))
+	}
+	if flag&(1<<7) != 0 {
+		s.trailer = headerMetadata(parseHeaderBlock(b))
+		st := statusFromMetadata(s.trailer)
+		if st == nil {
+			return s.fail(io.EOF)
+		}
+		return s.fail(st)
+	}
+	if err := proto.Unmarshal(b, m.(proto.Message)); err != nil {
+		return s.fail(status.Error(codes.Internal, err.Error()))
+	}
+	return nil
+}
+
+func (s *clientStream) readError(err error) error {
+	if s.ctx.Err() != nil {
+		return status.FromContextError(s.ctx.Err()).Err()
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return status.Error(codes.Internal, "grpcwebtest: stream ended without trailers")
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+// frameReader reads grpc-web frames.
+type frameReader struct {
+	r io.Reader
+}
+
+func (f *frameReader) next() (byte, []byte, error) {
+	var h [5]byte
+	if _, err := io.ReadFull(f.r, h[:]); err != nil {
+		return 0, nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint32(h[1:5]))
+	if _, err := io.ReadFull(f.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return h[0], b, nil
+}
+
+// wsReader reads websocket messages as a byte stream.
+type wsReader struct {
+	conn *websocket.Conn
+	buf  []byte
+}
+
+func (r *wsReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		_, b, err := r.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		r.buf = b
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// base64Reader decodes grpc-web-text responses: concatenated padded base64 parts.
+type base64Reader struct {
+	r       io.Reader
+	quantum []byte
+	buf     []byte
+}
+
+func (r *base64Reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		in := make([]byte, 512)
+		n, err := r.r.Read(in)
+		for _, c := range in[:n] {
+			r.quantum = append(r.quantum, c)
+			if len(r.quantum) < 4 {
+				continue
+			}
+			out := make([]byte, 3)
+			m, decodeErr := base64.StdEncoding.Decode(out, r.quantum)
+			if decodeErr != nil {
+				return 0, decodeErr
+			}
+			r.quantum = r.quantum[:0]
+			r.buf = append(r.buf, out[:m]...)
+		}
+		if err != nil && len(r.buf) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func parseHeaderBlock(b []byte) http.Header {
+	r := textproto.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(b), strings.NewReader("\r\n"))))
+	h, _ := r.ReadMIMEHeader()
+	return http.Header(h)
+}
+
+// headerMetadata converts HTTP headers to metadata with lower-case keys.
+func headerMetadata(h http.Header) metadata.MD {
+	md := make(metadata.MD, len(h))
+	for k, vv := range h {
+		k = strings.ToLower(k)
+		for _, v := range vv {
+			if strings.HasSuffix(k, "-bin") {
+				if b, err := base64.StdEncoding.DecodeString(v); err == nil {
+					v = string(b)
+				} else if b, err := base64.RawStdEncoding.DecodeString(v); err == nil {
+					v = string(b)
+				}
+			}
+			md[k] = append(md[k], v)
+		}
+	}
+	return md
+}
+
+// statusFromMetadata returns nil for OK status.
+func statusFromMetadata(md metadata.MD) error {
+	get := func(k string) string {
+		if vv := md.Get(k); len(vv) > 0 {
+			return vv[0]
+		}
+		return ""
+	}
+	code, err := strconv.Atoi(get("grpc-status"))
+	if err != nil {
+		return status.Error(codes.Internal, "grpcwebtest: missing grpc-status")
+	}
+	if code == int(codes.OK) {
+		return nil
+	}
+	msg, err := url.PathUnescape(get("grpc-message"))
+	if err != nil {
+		msg = get("grpc-message")
+	}
+	return status.Error(codes.Code(code), msg)
+}
+
+// httpError maps HTTP status of a failed request to gRPC status like gRPC clients do.
+func httpError(resp *http.Response) error {
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	msg := fmt.Sprintf("grpcwebtest: unexpected HTTP status %d: %s", resp.StatusCode, bytes.TrimSpace(b))
+	switch resp.StatusCode {
+	case http.StatusBadRequest:
+		return status.Error(codes.Internal, msg)
+	case http.StatusUnauthorized:
+		return status.Error(codes.Unauthenticated, msg)
+	case http.StatusForbidden:
+		return status.Error(codes.PermissionDenied, msg)
+	case http.StatusNotFound:
+		return status.Error(codes.Unimplemented, msg)
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return status.Error(codes.Unavailable, msg)
+	}
+	return status.Error(codes.Unknown, msg)
+}
@@ -0,0 +1,161 @@
+package grpcwebtest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gebv/go-utils/grpcwebserver"
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testService doubles durations, fails for zero and echoes the "x-echo" metadata.
+type testService interface{}
+
+func double(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(duration.Duration)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	grpc.SendHeader(ctx, metadata.MD{"x-echo": md.Get("x-echo")})
+	grpc.SetTrailer(ctx, metadata.Pairs("x-trailer", "t"))
+	if in.Seconds == 0 {
+		return nil, status.Error(codes.InvalidArgument, "zero duration")
+	}
+	return &duration.Duration{Seconds: in.Seconds * 2}, nil
+}
+
+func count(srv interface{}, stream grpc.ServerStream) error {
+	in := new(duration.Duration)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	for i := int64(1); i <= in.Seconds; i++ {
+		if err := stream.SendMsg(&duration.Duration{Seconds: i}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sum(srv interface{}, stream grpc.ServerStream) error {
+	var total int64
+	for {
+		in := new(duration.Duration)
+		err := stream.RecvMsg(in)
+		if err == io.EOF {
+			return stream.SendMsg(&duration.Duration{Seconds: total})
+		}
+		if err != nil {
+			return err
+		}
+		total += in.Seconds
+	}
+}
+
+var testServiceDesc = grpc.ServiceDesc{
+	ServiceName: "grpcwebtest.Test",
+	HandlerType: (*testService)(nil),
+	Methods:     []grpc.MethodDesc{{MethodName: "Double", Handler: double}},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Count", Handler: count, ServerStreams: true},
+		{StreamName: "Sum", Handler: sum, ClientStreams: true},
+	},
+}
+
+func newTestServer(opts ...grpcwebserver.Option) *Server {
+	gs := grpc.NewServer()
+	gs.RegisterService(&testServiceDesc, struct{}{})
+	return NewServer(gs, opts...)
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer()
+	defer srv.Close()
+
+	clients := map[string]*Client{
+		"binary":    srv.Client(),
+		"text":      srv.Client(WithTextFormat()),
+		"websocket": srv.Client(WithWebsockets()),
+	}
+	for name, c := range clients {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-echo", "hello")
+
+		var header, trailer metadata.MD
+		out := new(duration.Duration)
+		err := c.Invoke(ctx, "/grpcwebtest.Test/Double", &duration.Duration{Seconds: 21}, out, grpc.Header(&header), grpc.Trailer(&trailer))
+		require.NoError(t, err, name)
+		assert.Equal(t, int64(42), out.Seconds, name)
+		assert.Equal(t, []string{"hello"}, header.Get("x-echo"), name)
+		assert.Equal(t, []string{"t"}, trailer.Get("x-trailer"), name)
+
+		err = c.Invoke(ctx, "/grpcwebtest.Test/Double", &duration.Duration{}, out)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), name)
+		assert.Equal(t, "zero duration", status.Convert(err).Message(), name)
+
+		err = c.Invoke(ctx, "/grpcwebtest.Test/Unknown", &duration.Duration{}, out)
+		assert.Equal(t, codes.Unimplemented, status.Code(err), name)
+
+		stream, err := c.NewStream(ctx, &testServiceDesc.Streams[0], "/grpcwebtest.Test/Count")
+		require.NoError(t, err, name)
+		require.NoError(t, stream.SendMsg(&duration.Duration{Seconds: 3}), name)
+		require.NoError(t, stream.CloseSend(), name)
+		var got []int64
+		for {
+			err := stream.RecvMsg(out)
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err, name)
+			got = append(got, out.Seconds)
+		}
+		assert.Equal(t, []int64{1, 2, 3}, got, name)
+	}
+}
+
+func TestClientStreaming(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer()
+	defer srv.Close()
+
+	_, err := srv.Client().NewStream(context.Background(), &testServiceDesc.Streams[1], "/grpcwebtest.Test/Sum")
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	stream, err := srv.Client(WithWebsockets()).NewStream(context.Background(), &testServiceDesc.Streams[1], "/grpcwebtest.Test/Sum")
+	require.NoError(t, err)
+	for i := int64(1); i <= 4; i++ {
+		require.NoError(t, stream.SendMsg(&duration.Duration{Seconds: i}))
+	}
+	require.NoError(t, stream.CloseSend())
+	out := new(duration.Duration)
+	require.NoError(t, stream.RecvMsg(out))
+	assert.Equal(t, int64(10), out.Seconds)
+	assert.Equal(t, io.EOF, stream.RecvMsg(out))
+}
+
+func TestClientCORS(t *testing.T) {
+	t.Parallel()
+	srv := newTestServer(grpcwebserver.WithCORS(grpcwebserver.CORSPolicy{
+		AllowedOrigins: []string{"https://app.example.com"},
+	}))
+	defer srv.Close()
+
+	for _, opt := range []ClientOption{WithTextFormat(), WithWebsockets()} {
+		out := new(duration.Duration)
+		c := srv.Client(opt, WithHeader(http.Header{"Origin": {"https://app.example.com"}}))
+		assert.NoError(t, c.Invoke(context.Background(), "/grpcwebtest.Test/Double", &duration.Duration{Seconds: 1}, out))
+
+		c = srv.Client(opt, WithHeader(http.Header{"Origin": {"https://evil.example.com"}}))
+		err := c.Invoke(context.Background(), "/grpcwebtest.Test/Double", &duration.Duration{Seconds: 1}, out)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	}
+}
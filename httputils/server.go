@@ -0,0 +1,156 @@
+// Package httputils contains helpers shared by HTTP servers.
+package httputils
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerOptions hardens http.Server against slow and oversized requests.
+// Zero values mean no limit.
+type ServerOptions struct {
+	// ReadHeaderTimeout is the amount of time allowed to read request headers.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout is the amount of time allowed to read the entire request.
+	// It is not applied to long-lived requests.
+	ReadTimeout time.Duration
+	// WriteTimeout is the amount of time allowed to handle the request and
+	// write the response. It is not applied to long-lived requests.
+	WriteTimeout time.Duration
+	// IdleTimeout is how long keep-alive connections wait for the next request.
+	IdleTimeout time.Duration
+	// MaxHeaderBytes limits the size of request headers.
+	MaxHeaderBytes int
+	// MaxBodyBytes limits the size of request bodies.
+	// It is not applied to long-lived requests.
+	MaxBodyBytes int64
+	// RouteMaxBodyBytes overrides MaxBodyBytes by path prefix, the longest prefix wins.
+	RouteMaxBodyBytes map[string]int64
+	// MaxConns limits concurrent connections, further connections wait to be accepted.
+	MaxConns int
+	// LongLived reports whether the request is a long-lived stream.
+	// Websocket upgrades are always long-lived.
+	LongLived func(req *http.Request) bool
+}
+
+// DefaultServerOptions returns options used by servers in this repository by default.
+func DefaultServerOptions() ServerOptions {
+	return ServerOptions{
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    1 << 20,
+		MaxBodyBytes:      4 << 20,
+	}
+}
+
+// Configure sets timeouts and limits of srv and wraps its handler with Handler.
+func (o ServerOptions) Configure(srv *http.Server) {
+	srv.ReadHeaderTimeout = o.ReadHeaderTimeout
+	srv.IdleTimeout = o.IdleTimeout
+	srv.MaxHeaderBytes = o.MaxHeaderBytes
+
+	h := srv.Handler
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+	srv.Handler = o.Handler(h)
+}
+
+// Handler applies read and write timeouts and body size limits per request,
+// so long-lived requests such as websockets are not interrupted.
+func (o ServerOptions) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if o.isLongLived(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		// not all ResponseWriters support deadlines, e.g. HTTP/2 ones, ignore errors
+		rc := http.NewResponseController(w)
+		now := time.Now()
+		if o.ReadTimeout > 0 {
+			rc.SetReadDeadline(now.Add(o.ReadTimeout))
+		}
+		if o.WriteTimeout > 0 {
+			rc.SetWriteDeadline(now.Add(o.WriteTimeout))
+		}
+		if n := o.maxBodyBytes(req.URL.Path); n > 0 && req.Body != nil && req.Body != http.NoBody {
+			req.Body = http.MaxBytesReader(w, req.Body, n)
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (o ServerOptions) isLongLived(req *http.Request) bool {
+	if strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		return true
+	}
+	return o.LongLived != nil && o.LongLived(req)
+}
+
+func (o ServerOptions) maxBodyBytes(path string) int64 {
+	n, prefixLen := o.MaxBodyBytes, -1
+	for prefix, limit := range o.RouteMaxBodyBytes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > prefixLen {
+			n, prefixLen = limit, len(prefix)
+		}
+	}
+	return n
+}
+
+// Listener limits concurrent connections accepted from lis.
+func (o ServerOptions) Listener(lis net.Listener) net.Listener {
+	if o.MaxConns <= 0 {
+		return lis
+	}
+	return &limitListener{
+		Listener: lis,
+		sem:      make(chan struct{}, o.MaxConns),
+		done:     make(chan struct{}),
+	}
+}
+
+// limitListener blocks Accept while MaxConns connections are open.
+type limitListener struct {
+	net.Listener
+	sem       chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitConn{Conn: c, release: func() { <-l.sem }}, nil
+}
+
+func (l *limitListener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() { close(l.done) })
+	return err
+}
+
+type limitConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
@@ -0,0 +1,107 @@
+package httputils
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerOptionsHandler(t *testing.T) {
+	t.Parallel()
+	o := ServerOptions{
+		WriteTimeout:      50 * time.Millisecond,
+		MaxBodyBytes:      4,
+		RouteMaxBodyBytes: map[string]int64{"/upload/": 8},
+		LongLived:         func(req *http.Request) bool { return req.URL.Path == "/stream" },
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, err := ioutil.ReadAll(req.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if req.URL.Query().Get("sleep") != "" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.Write([]byte("ok"))
+	}))
+	o.Configure(srv.Config)
+	srv.Start()
+	defer srv.Close()
+
+	post := func(path, body string) (int, error) {
+		resp, err := http.Post(srv.URL+path, "text/plain", strings.NewReader(body))
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		_, err = ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, err
+	}
+
+	code, err := post("/", "1234")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, err = post("/", "12345")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+
+	code, err = post("/upload/file", "12345678")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+
+	_, err = post("/?sleep=1", "")
+	assert.Error(t, err, "write timeout")
+
+	code, err = post("/stream?sleep=1", "123456789")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestServerOptionsListener(t *testing.T) {
+	t.Parallel()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	lis = ServerOptions{MaxConns: 1}.Listener(lis)
+	defer lis.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	c1, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	defer c1.Close()
+	c2, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	defer c2.Close()
+
+	first := <-accepted
+	select {
+	case <-accepted:
+		t.Fatal("second connection accepted over the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(time.Second):
+		t.Fatal("second connection not accepted")
+	}
+}
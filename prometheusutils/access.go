@@ -0,0 +1,172 @@
+package prometheusutils
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// AccessRule checks the request to the metrics or debug server.
+// It returns nil if the request is allowed.
+type AccessRule func(req *http.Request) error
+
+var (
+	errBasicAuth       = errors.New("invalid basic auth credentials")
+	errBearerToken     = errors.New("invalid bearer token")
+	errAddress         = errors.New("address is not allowed")
+	errClientCert      = errors.New("no verified client certificate")
+	errClientCertName  = errors.New("client certificate is not allowed")
+	errNoAccessRules   = errors.New("no access rules")
+	basicAuthChallenge = `Basic realm="metrics", charset="UTF-8"`
+)
+
+// BasicAuth allows requests with the given basic auth credentials.
+// It denies all requests if username or password is empty.
+func BasicAuth(username, password string) AccessRule {
+	if username == "" || password == "" {
+		zap.L().Warn("Basic auth with empty credentials denies all requests.")
+		return denyAll(errBasicAuth)
+	}
+	return func(req *http.Request) error {
+		u, p, ok := req.BasicAuth()
+		if !ok || !secureEqual(u, username) || !secureEqual(p, password) {
+			return errBasicAuth
+		}
+		return nil
+	}
+}
+
+// BearerToken allows requests with "Authorization: Bearer <token>" header.
+// It denies all requests if token is empty.
+func BearerToken(token string) AccessRule {
+	if token == "" {
+		zap.L().Warn("Bearer token auth with empty token denies all requests.")
+		return denyAll(errBearerToken)
+	}
+	return func(req *http.Request) error {
+		const prefix = "Bearer "
+		h := req.Header.Get("Authorization")
+		if len(h) < len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) || !secureEqual(h[len(prefix):], token) {
+			return errBearerToken
+		}
+		return nil
+	}
+}
+
+// denyAll denies all requests with err.
+func denyAll(err error) AccessRule {
+	return func(req *http.Request) error {
+		return err
+	}
+}
+
+// AllowCIDRs allows requests from the given networks, for example "10.0.0.0/8" or "127.0.0.1/32".
+// The address of the connection peer is checked, X-Forwarded-For is ignored.
+func AllowCIDRs(cidrs ...string) (AccessRule, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return func(req *http.Request) error {
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			host = req.RemoteAddr
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			for _, n := range nets {
+				if n.Contains(ip) {
+					return nil
+				}
+			}
+		}
+		return errAddress
+	}, nil
+}
+
+// ClientCertificate allows requests with a client certificate verified by the server TLS config
+// (see WithTLS). If commonNames are given the certificate subject common name must be one of them.
+func ClientCertificate(commonNames ...string) AccessRule {
+	return func(req *http.Request) error {
+		if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+			return errClientCert
+		}
+		if len(commonNames) == 0 {
+			return nil
+		}
+		cn := req.TLS.VerifiedChains[0][0].Subject.CommonName
+		for _, n := range commonNames {
+			if n == cn {
+				return nil
+			}
+		}
+		return errClientCertName
+	}
+}
+
+// AllOf allows requests allowed by all rules.
+func AllOf(rules ...AccessRule) AccessRule {
+	return func(req *http.Request) error {
+		for _, r := range rules {
+			if err := r(req); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// AnyOf allows requests allowed by at least one of rules.
+func AnyOf(rules ...AccessRule) AccessRule {
+	return func(req *http.Request) error {
+		if len(rules) == 0 {
+			return errNoAccessRules
+		}
+		errs := make([]error, 0, len(rules))
+		for _, r := range rules {
+			err := r(req)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// accessHandler rejects requests not allowed by rule.
+func accessHandler(rule AccessRule, l *zap.Logger, next http.Handler) http.Handler {
+	if rule == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		err := rule(req)
+		if err == nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		l.Warn("Access denied.", zap.String("remote_addr", req.RemoteAddr), zap.String("path", req.URL.Path), zap.Error(err))
+		switch {
+		case errors.Is(err, errBasicAuth):
+			w.Header().Set("WWW-Authenticate", basicAuthChallenge)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		case errors.Is(err, errBearerToken):
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		default:
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		}
+	})
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
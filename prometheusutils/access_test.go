@@ -0,0 +1,62 @@
+package prometheusutils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestAccessRules(t *testing.T) {
+	cidrs, err := AllowCIDRs("10.0.0.0/8")
+	require.NoError(t, err)
+	_, err = AllowCIDRs("10.0.0.0")
+	require.Error(t, err)
+
+	rule := AllOf(cidrs, AnyOf(BasicAuth("user", "secret"), BearerToken("token"), ClientCertificate("prometheus")))
+	h := accessHandler(rule, zap.NewNop(), http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		remote string
+		setup  func(req *http.Request)
+		code   int
+	}{
+		{"basic", "10.1.2.3:1234", func(req *http.Request) { req.SetBasicAuth("user", "secret") }, http.StatusOK},
+		{"wrong password", "10.1.2.3:1234", func(req *http.Request) { req.SetBasicAuth("user", "wrong") }, http.StatusUnauthorized},
+		{"bearer", "10.1.2.3:1234", func(req *http.Request) { req.Header.Set("Authorization", "Bearer token") }, http.StatusOK},
+		{"client cert", "10.1.2.3:1234", func(req *http.Request) {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "prometheus"}}}}}
+		}, http.StatusOK},
+		{"other client cert", "10.1.2.3:1234", func(req *http.Request) {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "other"}}}}}
+		}, http.StatusUnauthorized},
+		{"network", "192.168.1.1:1234", func(req *http.Request) { req.SetBasicAuth("user", "secret") }, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.RemoteAddr = tt.remote
+		tt.setup(req)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, tt.code, rec.Code, tt.name)
+	}
+}
+
+func TestAccessRulesEmptySecrets(t *testing.T) {
+	basic := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	basic.SetBasicAuth("", "")
+	assert.Equal(t, errBasicAuth, BasicAuth("", "")(basic))
+	basic.SetBasicAuth("user", "")
+	assert.Equal(t, errBasicAuth, BasicAuth("user", "")(basic))
+
+	bearer := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	bearer.Header.Set("Authorization", "Bearer ")
+	assert.Equal(t, errBearerToken, BearerToken("")(bearer))
+}
@@ -0,0 +1,343 @@
+package prometheusutils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+type bridgeFormat int
+
+const (
+	formatStatsD bridgeFormat = iota
+	formatDogStatsD
+	formatGraphite
+)
+
+// maxStatsDPacket keeps UDP packets under the common MTU.
+const maxStatsDPacket = 1432
+
+// BridgeOption configures Bridge.
+type BridgeOption func(b *Bridge)
+
+// WithBridgePrefix sets the prefix of metric names, for example "myapp" or "myapp.eu".
+// Special characters of dot separated parts are replaced as in metric names.
+func WithBridgePrefix(prefix string) BridgeOption {
+	return func(b *Bridge) {
+		parts := strings.Split(strings.Trim(prefix, "."), ".")
+		for i, p := range parts {
+			parts[i] = sanitize(p)
+		}
+		b.prefix = strings.Join(parts, ".")
+	}
+}
+
+// WithBridgeInterval sets how often Run sends metrics. Defaults to 10 seconds.
+func WithBridgeInterval(d time.Duration) BridgeOption {
+	return func(b *Bridge) {
+		b.interval = d
+	}
+}
+
+// WithCounterDeltas sets whether counters are sent as increments since the previous flush.
+// The first flush only records counter values. Otherwise counters are sent as cumulative gauges.
+// Defaults to true for StatsD and false for Graphite.
+func WithCounterDeltas(enabled bool) BridgeOption {
+	return func(b *Bridge) {
+		b.deltas = enabled
+	}
+}
+
+// Bridge periodically gathers metrics and sends them to StatsD or Graphite.
+// Any gatherer works, for example a registry with dbstat.DBStats.
+//
+// Labels are sent as DogStatsD tags or appended to the name as ".<label>.<value>".
+// Histograms and summaries are sent as "_sum", "_count" and per bucket or quantile series.
+type Bridge struct {
+	format   bridgeFormat
+	address  string
+	gatherer prometheus.Gatherer
+	prefix   string
+	interval time.Duration
+	deltas   bool
+	l        *zap.Logger
+
+	mu   sync.Mutex
+	last map[string]float64
+	conn net.Conn
+}
+
+// NewStatsDBridge returns a bridge sending metrics over UDP to StatsD at address.
+func NewStatsDBridge(address string, g prometheus.Gatherer, opts ...BridgeOption) *Bridge {
+	return newBridge(formatStatsD, address, g, true, opts)
+}
+
+// NewDogStatsDBridge returns a bridge sending metrics with tags over UDP to DogStatsD at address.
+func NewDogStatsDBridge(address string, g prometheus.Gatherer, opts ...BridgeOption) *Bridge {
+	return newBridge(formatDogStatsD, address, g, true, opts)
+}
+
+// NewGraphiteBridge returns a bridge sending metrics over TCP to Graphite plaintext protocol at address.
+func NewGraphiteBridge(address string, g prometheus.Gatherer, opts ...BridgeOption) *Bridge {
+	return newBridge(formatGraphite, address, g, false, opts)
+}
+
+func newBridge(format bridgeFormat, address string, g prometheus.Gatherer, deltas bool, opts []BridgeOption) *Bridge {
+	b := &Bridge{
+		format:   format,
+		address:  address,
+		gatherer: g,
+		interval: 10 * time.Second,
+		deltas:   deltas,
+		l:        zap.L().Named("bridge"),
+		last:     make(map[string]float64),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Run sends metrics every interval until ctx is done, then sends them the last time.
+// Failed sends are logged.
+func (b *Bridge) Run(ctx context.Context) {
+	t := time.NewTicker(b.interval)
+	defer t.Stop()
+	defer b.Close()
+
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			if err := b.Flush(); err != nil {
+				b.l.Error("Failed to send metrics.", zap.String("address", b.address), zap.Error(err))
+			}
+			return
+		}
+		if err := b.Flush(); err != nil {
+			b.l.Error("Failed to send metrics.", zap.String("address", b.address), zap.Error(err))
+		}
+	}
+}
+
+// Flush gathers and sends metrics once.
+func (b *Bridge) Flush() error {
+	mfs, err := b.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	var lines []string
+	// counters not gathered anymore are dropped from the previous values
+	next := make(map[string]float64, len(b.last))
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, s := range samples(mf, m) {
+				if line, ok := b.line(s, now, next); ok {
+					lines = append(lines, line)
+				}
+			}
+		}
+	}
+	b.last = next
+	if len(lines) == 0 {
+		return nil
+	}
+	if b.format == formatGraphite {
+		return b.sendTCP(lines)
+	}
+	return b.sendUDP(lines)
+}
+
+// Close closes the UDP connection.
+func (b *Bridge) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		return nil
+	}
+	err := b.conn.Close()
+	b.conn = nil
+	return err
+}
+
+func (b *Bridge) sendUDP(lines []string) error {
+	if b.conn == nil {
+		conn, err := net.Dial("udp", b.address)
+		if err != nil {
+			return err
+		}
+		b.conn = conn
+	}
+
+	var packet bytes.Buffer
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := b.conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxStatsDPacket {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	return flush()
+}
+
+func (b *Bridge) sendTCP(lines []string) error {
+	conn, err := net.DialTimeout("tcp", b.address, b.interval)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(b.interval))
+	_, err = conn.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	return err
+}
+
+// sample is a single value of a metric family.
+type sample struct {
+	name    string
+	labels  []*dto.LabelPair
+	value   float64
+	counter bool
+}
+
+// samples flattens m to samples.
+func samples(mf *dto.MetricFamily, m *dto.Metric) []sample {
+	name, labels := mf.GetName(), m.GetLabel()
+	withLabel := func(n, v string) []*dto.LabelPair {
+		return append(append([]*dto.LabelPair{}, labels...), &dto.LabelPair{Name: &n, Value: &v})
+	}
+
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		return []sample{{name, labels, m.GetCounter().GetValue(), true}}
+	case dto.MetricType_GAUGE:
+		return []sample{{name, labels, m.GetGauge().GetValue(), false}}
+	case dto.MetricType_UNTYPED:
+		return []sample{{name, labels, m.GetUntyped().GetValue(), false}}
+	case dto.MetricType_HISTOGRAM:
+		h := m.GetHistogram()
+		res := []sample{
+			{name + "_sum", labels, h.GetSampleSum(), true},
+			{name + "_count", labels, float64(h.GetSampleCount()), true},
+		}
+		for _, bucket := range h.GetBucket() {
+			le := strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64)
+			res = append(res, sample{name + "_bucket", withLabel("le", le), float64(bucket.GetCumulativeCount()), true})
+		}
+		return res
+	case dto.MetricType_SUMMARY:
+		s := m.GetSummary()
+		res := []sample{
+			{name + "_sum", labels, s.GetSampleSum(), true},
+			{name + "_count", labels, float64(s.GetSampleCount()), true},
+		}
+		for _, q := range s.GetQuantile() {
+			quantile := strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64)
+			res = append(res, sample{name, withLabel("quantile", quantile), q.GetValue(), false})
+		}
+		return res
+	}
+	return nil
+}
+
+// line formats s, computing counter deltas from b.last and recording counter values to next.
+// It returns false for samples which should not be sent: NaN and infinite values,
+// and first seen counters, whose values are recorded as the baseline.
+func (b *Bridge) line(s sample, now time.Time, next map[string]float64) (string, bool) {
+	if math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+		return "", false
+	}
+	f := b.format
+	name := sanitize(s.name)
+	if b.prefix != "" {
+		name = b.prefix + "." + name
+	}
+	var tags []string
+	for _, lp := range s.labels {
+		if f == formatDogStatsD {
+			tags = append(tags, sanitize(lp.GetName())+":"+sanitize(lp.GetValue()))
+		} else {
+			name += "." + sanitize(lp.GetName()) + "." + sanitize(lp.GetValue())
+		}
+	}
+	sort.Strings(tags)
+
+	value := s.value
+	counter := s.counter && b.deltas
+	if counter {
+		key := name + "|" + strings.Join(tags, ",")
+		last, ok := b.last[key]
+		next[key] = value
+		if !ok {
+			return "", false
+		}
+		if value >= last {
+			// a smaller value means the counter was reset, send it as is
+			value -= last
+		}
+		if value == 0 && f != formatGraphite {
+			return "", false
+		}
+	}
+
+	v := strconv.FormatFloat(value, 'f', -1, 64)
+	if f == formatGraphite {
+		return fmt.Sprintf("%s %s %d", name, v, now.Unix()), true
+	}
+
+	suffix := "|" + statsdType(counter)
+	if len(tags) > 0 {
+		suffix += "|#" + strings.Join(tags, ",")
+	}
+	line := name + ":" + v + suffix
+	if !counter && value < 0 {
+		// signed StatsD gauge values are relative, reset the gauge first
+		line = name + ":0" + suffix + "\n" + line
+	}
+	return line, true
+}
+
+func statsdType(counter bool) string {
+	if counter {
+		return "c"
+	}
+	return "g"
+}
+
+// sanitize replaces characters which have special meaning in StatsD and Graphite.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,127 @@
+package prometheusutils
+
+import (
+	"bufio"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDogStatsDBridge(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total"}, []string{"code"})
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "temperature"})
+	nan := prometheus.NewGauge(prometheus.GaugeOpts{Name: "ratio"})
+	reg.MustRegister(c, g, nan)
+	c.WithLabelValues("200").Add(3)
+	g.Set(-2)
+	nan.Set(math.NaN())
+
+	b := NewDogStatsDBridge(pc.LocalAddr().String(), reg, WithBridgePrefix("app"))
+	defer b.Close()
+
+	read := func() []string {
+		buf := make([]byte, maxStatsDPacket)
+		pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		require.NoError(t, err)
+		lines := strings.Split(string(buf[:n]), "\n")
+		sort.Strings(lines)
+		return lines
+	}
+
+	// the first flush records the counter baseline
+	require.NoError(t, b.Flush())
+	assert.Equal(t, []string{"app.temperature:-2|g", "app.temperature:0|g"}, read())
+
+	c.WithLabelValues("200").Add(2)
+	c.WithLabelValues("500").Add(1)
+	g.Set(1)
+	nan.Set(math.Inf(1))
+	require.NoError(t, b.Flush())
+	assert.Equal(t, []string{"app.requests_total:2|c|#code:200", "app.temperature:1|g"}, read())
+
+	c.WithLabelValues("500").Add(4)
+	require.NoError(t, b.Flush())
+	assert.Equal(t, []string{"app.requests_total:4|c|#code:500", "app.temperature:1|g"}, read())
+
+	// a deleted counter is forgotten, it starts with a new baseline
+	c.DeleteLabelValues("500")
+	require.NoError(t, b.Flush())
+	assert.Equal(t, []string{"app.temperature:1|g"}, read())
+	c.WithLabelValues("500").Add(1)
+	require.NoError(t, b.Flush())
+	assert.Equal(t, []string{"app.temperature:1|g"}, read())
+	assert.Len(t, b.last, 2)
+}
+
+func TestBridgeSanitizeNames(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "job:requests:rate5m"})
+	reg.MustRegister(g)
+	g.Set(1)
+
+	b := NewStatsDBridge(pc.LocalAddr().String(), reg, WithBridgePrefix("my app|eu.prod:1."))
+	defer b.Close()
+	require.NoError(t, b.Flush())
+
+	buf := make([]byte, maxStatsDPacket)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "my_app_eu.prod_1.job_requests_rate5m:1|g", string(buf[:n]))
+}
+
+func TestGraphiteBridge(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total"}, []string{"code"})
+	reg.MustRegister(c)
+	c.WithLabelValues("200").Add(3)
+
+	b := NewGraphiteBridge(lis.Addr().String(), reg, WithBridgePrefix("app"), WithCounterDeltas(true))
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			s := bufio.NewScanner(conn)
+			for s.Scan() {
+				lines <- s.Text()
+			}
+			conn.Close()
+		}
+	}()
+
+	require.NoError(t, b.Flush())
+	c.WithLabelValues("200").Add(2)
+	require.NoError(t, b.Flush())
+	require.NoError(t, b.Flush())
+
+	for _, v := range []string{"2", "0"} {
+		fields := strings.Fields(<-lines)
+		require.Len(t, fields, 3)
+		assert.Equal(t, "app.requests_total.code.200", fields[0])
+		assert.Equal(t, v, fields[1])
+	}
+}
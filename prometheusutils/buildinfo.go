@@ -0,0 +1,122 @@
+package prometheusutils
+
+import (
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+// Build details set with ldflags, for example:
+//
+//	go build -ldflags "-X github.com/gebv/go-utils/prometheusutils.Commit=$(git rev-parse HEAD)"
+//
+// Empty values are populated from runtime/debug build info when possible.
+var (
+	Version   string
+	Commit    string
+	Branch    string
+	BuildDate string
+)
+
+// processStartTime is read from procfs where available, otherwise it is
+// the package initialization time, which is close to the process start.
+var processStartTime = readProcessStartTime()
+
+func readProcessStartTime() time.Time {
+	if p, err := procfs.Self(); err == nil {
+		if stat, err := p.NewStat(); err == nil {
+			if sec, err := stat.StartTime(); err == nil {
+				return time.Unix(0, int64(sec*1e9))
+			}
+		}
+	}
+	return time.Now()
+}
+
+// BuildInfo describes the binary.
+type BuildInfo struct {
+	Version   string
+	Commit    string
+	Branch    string
+	GoVersion string
+	BuildDate string
+}
+
+// ReadBuildInfo returns build info of the binary. Pass the value given to
+// logger.SetLogger as LoggerConfig.Version or to zapsentry.WithRelease as version,
+// so metrics and Sentry events have the same version. If version is empty
+// Version variable or the main module version is used.
+func ReadBuildInfo(version string) BuildInfo {
+	bi := BuildInfo{
+		Version:   version,
+		Commit:    Commit,
+		Branch:    Branch,
+		GoVersion: runtime.Version(),
+		BuildDate: BuildDate,
+	}
+	if bi.Version == "" {
+		bi.Version = Version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return bi
+	}
+	if bi.Version == "" && info.Main.Version != "(devel)" {
+		bi.Version = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision" && bi.Commit == "":
+			bi.Commit = s.Value
+		case s.Key == "vcs.time" && bi.BuildDate == "":
+			bi.BuildDate = s.Value
+		}
+	}
+	return bi
+}
+
+// BuildInfoCollector exports build info, process start time and uptime.
+type BuildInfoCollector struct {
+	info      BuildInfo
+	buildInfo *prometheus.Desc
+	startTime *prometheus.Desc
+	uptime    *prometheus.Desc
+}
+
+// NewBuildInfoCollector returns a collector of "<prefix>_build_info", "<prefix>_start_time_seconds"
+// and "<prefix>_uptime_seconds" metrics. Names have no prefix if it is empty.
+// See ReadBuildInfo for version.
+func NewBuildInfoCollector(prefix string, version string) *BuildInfoCollector {
+	if prefix != "" {
+		prefix += "_"
+	}
+	return &BuildInfoCollector{
+		info: ReadBuildInfo(version),
+		buildInfo: prometheus.NewDesc(prefix+"build_info", "A metric with a constant '1' value labeled by build details.",
+			[]string{"version", "commit", "branch", "goversion", "build_date"}, nil),
+		startTime: prometheus.NewDesc(prefix+"start_time_seconds", "Start time of the process since unix epoch in seconds.", nil, nil),
+		uptime:    prometheus.NewDesc(prefix+"uptime_seconds", "Time since the process start in seconds.", nil, nil),
+	}
+}
+
+func (c *BuildInfoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.buildInfo
+	ch <- c.startTime
+	ch <- c.uptime
+}
+
+func (c *BuildInfoCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.buildInfo, prometheus.GaugeValue, 1,
+		c.info.Version, c.info.Commit, c.info.Branch, c.info.GoVersion, c.info.BuildDate)
+	ch <- prometheus.MustNewConstMetric(c.startTime, prometheus.GaugeValue, float64(processStartTime.UnixNano())/1e9)
+	ch <- prometheus.MustNewConstMetric(c.uptime, prometheus.GaugeValue, time.Since(processStartTime).Seconds())
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*BuildInfoCollector)(nil)
+)
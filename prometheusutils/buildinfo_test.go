@@ -0,0 +1,37 @@
+package prometheusutils
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildInfoCollector(t *testing.T) {
+	commit, branch := Commit, Branch
+	Commit, Branch = "abc123", "master"
+	defer func() { Commit, Branch = commit, branch }()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(NewBuildInfoCollector("app", "v1.2.3"))
+
+	labels := map[string]string{"version": "v1.2.3", "commit": "abc123", "branch": "master", "goversion": runtime.Version()}
+	assert.Equal(t, 1.0, metricValue(t, reg, "app_build_info", labels))
+	start := metricValue(t, reg, "app_start_time_seconds", nil)
+	assert.True(t, start > 0 && start <= float64(time.Now().Add(time.Second).Unix()), "start time %v", start)
+	assert.True(t, metricValue(t, reg, "app_uptime_seconds", nil) >= 0)
+}
+
+func TestReadProcessStartTime(t *testing.T) {
+	// boot time in procfs has a second resolution
+	start := readProcessStartTime()
+	assert.False(t, start.After(time.Now().Add(time.Second)))
+	if _, err := procfs.Self(); err == nil {
+		// the test binary started before the package was initialized
+		assert.False(t, start.After(processStartTime.Add(time.Second)))
+		assert.True(t, time.Since(start) < time.Hour, "start time %v", start)
+	}
+}
@@ -0,0 +1,309 @@
+package prometheusutils
+
+import (
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// OverflowLabelValue replaces all label values of series over the cardinality limit.
+const OverflowLabelValue = "__overflow__"
+
+// maxDroppedSeries bounds distinct dropped label sets remembered per vector.
+const maxDroppedSeries = 10000
+
+// CardinalityGuard wraps prometheus.Registerer. Vectors created with it have at most
+// limit series; observations for new label values over the limit are collapsed
+// into the series with all labels set to OverflowLabelValue.
+// Only vectors created by NewCounterVec, NewGaugeVec and NewHistogramVec are
+// limited, collectors passed to Register and MustRegister are registered as is.
+type CardinalityGuard struct {
+	reg      prometheus.Registerer
+	limit    int
+	overflow *prometheus.CounterVec
+	dropped  *prometheus.CounterVec
+	l        *zap.Logger
+}
+
+// NewCardinalityGuard returns a guard registering vectors with reg,
+// "<prefix>_cardinality_overflow_observations_total" counter of observations
+// collapsed into overflow series and "<prefix>_cardinality_dropped_series_total"
+// counter of distinct dropped label sets. Hashes of dropped label sets are
+// remembered up to 10000 per vector, label sets over it are not counted.
+func NewCardinalityGuard(reg prometheus.Registerer, prefix string, limit int) *CardinalityGuard {
+	g := &CardinalityGuard{
+		reg:   reg,
+		limit: limit,
+		overflow: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_cardinality_overflow_observations_total",
+			Help: "The total number of observations with new label values over the series limit collapsed into the overflow series.",
+		}, []string{"metric"}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_cardinality_dropped_series_total",
+			Help: "The total number of distinct label sets over the series limit.",
+		}, []string{"metric"}),
+		l: zap.L().Named("cardinalityGuard"),
+	}
+	reg.MustRegister(g.overflow, g.dropped)
+	return g
+}
+
+// Register implements prometheus.Registerer. The collector is not limited.
+func (g *CardinalityGuard) Register(c prometheus.Collector) error {
+	return g.reg.Register(c)
+}
+
+// MustRegister implements prometheus.Registerer. Collectors are not limited.
+func (g *CardinalityGuard) MustRegister(cs ...prometheus.Collector) {
+	g.reg.MustRegister(cs...)
+}
+
+// Unregister implements prometheus.Registerer.
+func (g *CardinalityGuard) Unregister(c prometheus.Collector) bool {
+	return g.reg.Unregister(c)
+}
+
+// NewCounterVec creates and registers a guarded counter vector. It panics if registration fails.
+func (g *CardinalityGuard) NewCounterVec(opts prometheus.CounterOpts, labelNames []string) *GuardedCounterVec {
+	vec := prometheus.NewCounterVec(opts, labelNames)
+	g.reg.MustRegister(vec)
+	return &GuardedCounterVec{vec: vec, series: g.newSeries(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), labelNames)}
+}
+
+// NewGaugeVec creates and registers a guarded gauge vector. It panics if registration fails.
+func (g *CardinalityGuard) NewGaugeVec(opts prometheus.GaugeOpts, labelNames []string) *GuardedGaugeVec {
+	vec := prometheus.NewGaugeVec(opts, labelNames)
+	g.reg.MustRegister(vec)
+	return &GuardedGaugeVec{vec: vec, series: g.newSeries(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), labelNames)}
+}
+
+// NewHistogramVec creates and registers a guarded histogram vector. It panics if registration fails.
+func (g *CardinalityGuard) NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string) *GuardedHistogramVec {
+	vec := prometheus.NewHistogramVec(opts, labelNames)
+	g.reg.MustRegister(vec)
+	return &GuardedHistogramVec{vec: vec, series: g.newSeries(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), labelNames)}
+}
+
+func (g *CardinalityGuard) newSeries(name string, labelNames []string) *seriesGuard {
+	overflow := make([]string, len(labelNames))
+	for i := range overflow {
+		overflow[i] = OverflowLabelValue
+	}
+	return &seriesGuard{
+		g:             g,
+		name:          name,
+		labelNames:    labelNames,
+		seen:          make(map[string]struct{}),
+		droppedSeries: make(map[uint64]struct{}),
+		overflow:      overflow,
+		observations:  g.overflow.WithLabelValues(name),
+		dropped:       g.dropped.WithLabelValues(name),
+	}
+}
+
+// seriesGuard tracks series of a vector.
+type seriesGuard struct {
+	g            *CardinalityGuard
+	name         string
+	labelNames   []string
+	overflow     []string
+	observations prometheus.Counter
+	dropped      prometheus.Counter
+
+	mu            sync.Mutex
+	seen          map[string]struct{}
+	droppedSeries map[uint64]struct{} // hashes of dropped label sets
+	warn          sync.Once
+}
+
+// labelValues returns lvs or overflow label values if lvs are new and the limit is reached.
+func (s *seriesGuard) labelValues(lvs []string) []string {
+	key := strings.Join(lvs, "\xff")
+
+	s.mu.Lock()
+	_, ok := s.seen[key]
+	if !ok && len(s.seen) < s.g.limit {
+		s.seen[key] = struct{}{}
+		ok = true
+	}
+	var newDropped bool
+	if !ok && len(s.droppedSeries) < maxDroppedSeries {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		sum := h.Sum64()
+		if _, seen := s.droppedSeries[sum]; !seen {
+			s.droppedSeries[sum] = struct{}{}
+			newDropped = true
+		}
+	}
+	s.mu.Unlock()
+	if ok {
+		return lvs
+	}
+
+	s.observations.Inc()
+	if newDropped {
+		s.dropped.Inc()
+	}
+	s.warn.Do(func() {
+		s.g.l.Warn("Metric series limit reached, new label values are collapsed.",
+			zap.String("metric", s.name), zap.Int("limit", s.g.limit), zap.Strings("labels", lvs))
+	})
+	return s.overflow
+}
+
+// release frees the slot of lvs.
+func (s *seriesGuard) release(lvs []string) {
+	key := strings.Join(lvs, "\xff")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.seen, key)
+}
+
+func (s *seriesGuard) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen = make(map[string]struct{})
+	s.droppedSeries = make(map[uint64]struct{})
+}
+
+// labels converts labels to label values in the vector order.
+func (s *seriesGuard) labels(labels prometheus.Labels) []string {
+	lvs := make([]string, len(s.labelNames))
+	for i, name := range s.labelNames {
+		lvs[i] = labels[name]
+	}
+	return lvs
+}
+
+// GuardedCounterVec is a counter vector with a series limit.
+type GuardedCounterVec struct {
+	vec    *prometheus.CounterVec
+	series *seriesGuard
+}
+
+// WithLabelValues works as prometheus.CounterVec.WithLabelValues.
+func (v *GuardedCounterVec) WithLabelValues(lvs ...string) prometheus.Counter {
+	return v.vec.WithLabelValues(v.series.labelValues(lvs)...)
+}
+
+// With works as prometheus.CounterVec.With.
+func (v *GuardedCounterVec) With(labels prometheus.Labels) prometheus.Counter {
+	return v.WithLabelValues(v.series.labels(labels)...)
+}
+
+// DeleteLabelValues works as prometheus.CounterVec.DeleteLabelValues and frees
+// the series slot for new label values.
+func (v *GuardedCounterVec) DeleteLabelValues(lvs ...string) bool {
+	if !v.vec.DeleteLabelValues(lvs...) {
+		return false
+	}
+	v.series.release(lvs)
+	return true
+}
+
+// Delete works as prometheus.CounterVec.Delete and frees the series slot for new label values.
+func (v *GuardedCounterVec) Delete(labels prometheus.Labels) bool {
+	if !v.vec.Delete(labels) {
+		return false
+	}
+	v.series.release(v.series.labels(labels))
+	return true
+}
+
+// Reset works as prometheus.CounterVec.Reset and frees all series slots.
+func (v *GuardedCounterVec) Reset() {
+	v.series.reset()
+	v.vec.Reset()
+}
+
+// GuardedGaugeVec is a gauge vector with a series limit.
+type GuardedGaugeVec struct {
+	vec    *prometheus.GaugeVec
+	series *seriesGuard
+}
+
+// WithLabelValues works as prometheus.GaugeVec.WithLabelValues.
+func (v *GuardedGaugeVec) WithLabelValues(lvs ...string) prometheus.Gauge {
+	return v.vec.WithLabelValues(v.series.labelValues(lvs)...)
+}
+
+// With works as prometheus.GaugeVec.With.
+func (v *GuardedGaugeVec) With(labels prometheus.Labels) prometheus.Gauge {
+	return v.WithLabelValues(v.series.labels(labels)...)
+}
+
+// DeleteLabelValues works as prometheus.GaugeVec.DeleteLabelValues and frees
+// the series slot for new label values.
+func (v *GuardedGaugeVec) DeleteLabelValues(lvs ...string) bool {
+	if !v.vec.DeleteLabelValues(lvs...) {
+		return false
+	}
+	v.series.release(lvs)
+	return true
+}
+
+// Delete works as prometheus.GaugeVec.Delete and frees the series slot for new label values.
+func (v *GuardedGaugeVec) Delete(labels prometheus.Labels) bool {
+	if !v.vec.Delete(labels) {
+		return false
+	}
+	v.series.release(v.series.labels(labels))
+	return true
+}
+
+// Reset works as prometheus.GaugeVec.Reset and frees all series slots.
+func (v *GuardedGaugeVec) Reset() {
+	v.series.reset()
+	v.vec.Reset()
+}
+
+// GuardedHistogramVec is a histogram vector with a series limit.
+type GuardedHistogramVec struct {
+	vec    *prometheus.HistogramVec
+	series *seriesGuard
+}
+
+// WithLabelValues works as prometheus.HistogramVec.WithLabelValues.
+func (v *GuardedHistogramVec) WithLabelValues(lvs ...string) prometheus.Observer {
+	return v.vec.WithLabelValues(v.series.labelValues(lvs)...)
+}
+
+// With works as prometheus.HistogramVec.With.
+func (v *GuardedHistogramVec) With(labels prometheus.Labels) prometheus.Observer {
+	return v.WithLabelValues(v.series.labels(labels)...)
+}
+
+// DeleteLabelValues works as prometheus.HistogramVec.DeleteLabelValues and frees
+// the series slot for new label values.
+func (v *GuardedHistogramVec) DeleteLabelValues(lvs ...string) bool {
+	if !v.vec.DeleteLabelValues(lvs...) {
+		return false
+	}
+	v.series.release(lvs)
+	return true
+}
+
+// Delete works as prometheus.HistogramVec.Delete and frees the series slot for new label values.
+func (v *GuardedHistogramVec) Delete(labels prometheus.Labels) bool {
+	if !v.vec.Delete(labels) {
+		return false
+	}
+	v.series.release(v.series.labels(labels))
+	return true
+}
+
+// Reset works as prometheus.HistogramVec.Reset and frees all series slots.
+func (v *GuardedHistogramVec) Reset() {
+	v.series.reset()
+	v.vec.Reset()
+}
+
+// check interfaces
+var (
+	_ prometheus.Registerer = (*CardinalityGuard)(nil)
+)
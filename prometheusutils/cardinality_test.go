@@ -0,0 +1,63 @@
+package prometheusutils
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCardinalityGuard(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	g := NewCardinalityGuard(reg, "app", 2)
+	vec := g.NewCounterVec(prometheus.CounterOpts{Name: "logins_total"}, []string{"user", "result"})
+
+	vec.WithLabelValues("1", "ok").Inc()
+	vec.With(prometheus.Labels{"user": "2", "result": "ok"}).Inc()
+	vec.WithLabelValues("1", "ok").Inc()
+	vec.WithLabelValues("3", "ok").Inc()
+	vec.WithLabelValues("4", "fail").Inc()
+
+	assert.Equal(t, 2.0, metricValue(t, reg, "logins_total", map[string]string{"user": "1"}))
+	assert.Equal(t, 1.0, metricValue(t, reg, "logins_total", map[string]string{"user": "2"}))
+	assert.Equal(t, -1.0, metricValue(t, reg, "logins_total", map[string]string{"user": "3"}))
+	assert.Equal(t, 2.0, metricValue(t, reg, "logins_total", map[string]string{"user": OverflowLabelValue, "result": OverflowLabelValue}))
+	assert.Equal(t, 2.0, metricValue(t, reg, "app_cardinality_overflow_observations_total", map[string]string{"metric": "logins_total"}))
+	assert.Equal(t, 2.0, metricValue(t, reg, "app_cardinality_dropped_series_total", map[string]string{"metric": "logins_total"}))
+
+	// repeated observations of a dropped label set are not counted as new series
+	vec.WithLabelValues("3", "ok").Inc()
+	assert.Equal(t, 3.0, metricValue(t, reg, "app_cardinality_overflow_observations_total", map[string]string{"metric": "logins_total"}))
+	assert.Equal(t, 2.0, metricValue(t, reg, "app_cardinality_dropped_series_total", map[string]string{"metric": "logins_total"}))
+}
+
+func TestCardinalityGuardDelete(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	g := NewCardinalityGuard(reg, "app", 2)
+	gauge := g.NewGaugeVec(prometheus.GaugeOpts{Name: "sessions"}, []string{"user"})
+	hist := g.NewHistogramVec(prometheus.HistogramOpts{Name: "latency_seconds"}, []string{"user"})
+
+	gauge.WithLabelValues("1").Set(1)
+	gauge.WithLabelValues("2").Set(2)
+	assert.True(t, gauge.DeleteLabelValues("1"))
+	assert.False(t, gauge.DeleteLabelValues("1"))
+	gauge.WithLabelValues("3").Set(3)
+	assert.True(t, gauge.Delete(prometheus.Labels{"user": "2"}))
+	assert.False(t, gauge.Delete(prometheus.Labels{"other": "3"}))
+	gauge.WithLabelValues("4").Set(4)
+	gauge.WithLabelValues("5").Set(5)
+
+	assert.Equal(t, -1.0, metricValue(t, reg, "sessions", map[string]string{"user": "1"}))
+	assert.Equal(t, 3.0, metricValue(t, reg, "sessions", map[string]string{"user": "3"}))
+	assert.Equal(t, 4.0, metricValue(t, reg, "sessions", map[string]string{"user": "4"}))
+	assert.Equal(t, 5.0, metricValue(t, reg, "sessions", map[string]string{"user": OverflowLabelValue}))
+
+	hist.WithLabelValues("1").Observe(1)
+	hist.WithLabelValues("2").Observe(1)
+	hist.Reset()
+	hist.WithLabelValues("3").Observe(1)
+	hist.WithLabelValues("4").Observe(1)
+	assert.Equal(t, 1.0, metricValue(t, reg, "latency_seconds", map[string]string{"user": "4"}))
+	assert.Equal(t, -1.0, metricValue(t, reg, "latency_seconds", map[string]string{"user": OverflowLabelValue}))
+	assert.Equal(t, 1.0, metricValue(t, reg, "app_cardinality_overflow_observations_total", map[string]string{"metric": "sessions"}))
+}
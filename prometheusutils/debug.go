@@ -0,0 +1,203 @@
+package prometheusutils
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"html/template"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"golang.org/x/net/trace"
+)
+
+const debugShutdownTimeout = 5 * time.Second
+
+// DebugServer serves metrics and debug handlers on a private mux.
+type DebugServer struct {
+	opts  *options
+	mux   *http.ServeMux
+	srv   *http.Server
+	lis   net.Listener
+	paths []string
+	l     *zap.Logger
+}
+
+// NewDebugServer returns a new debug server. Call Start to begin serving.
+func NewDebugServer(address string, opts ...Option) *DebugServer {
+	o := newOptions(opts)
+	s := &DebugServer{
+		opts: o,
+		mux:  http.NewServeMux(),
+		l:    zap.L().Named("debugMux"),
+	}
+
+	s.Handle(o.metricsPath, promhttp.HandlerFor(o.gatherer(), promhttp.HandlerOpts{
+		ErrorLog:      logFunc(s.l.Sugar().Warn),
+		ErrorHandling: promhttp.HTTPErrorOnError,
+	}))
+	if o.expvar {
+		s.Handle("/debug/vars", expvar.Handler())
+	}
+	if o.trace {
+		s.Handle("/debug/requests", traceHandler(o.traceAuth, func(w http.ResponseWriter, req *http.Request, sensitive bool) {
+			trace.Render(w, req, sensitive)
+		}))
+		s.Handle("/debug/events", traceHandler(o.traceAuth, trace.RenderEvents))
+	}
+	if o.buildInfo {
+		s.Handle("/debug/buildinfo", buildInfoHandler(o.version))
+	}
+	s.mux.HandleFunc("/", s.serveIndex)
+
+	s.srv = &http.Server{Addr: address, Handler: accessHandler(o.access, s.l, s.mux)}
+	o.server.Configure(s.srv)
+	return s
+}
+
+// Handle registers handler on the debug mux and lists it on the index page.
+func (s *DebugServer) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+	s.paths = append(s.paths, pattern)
+}
+
+// Start starts listening and serving in background.
+// It returns an error if the server can't listen on the address.
+func (s *DebugServer) Start() error {
+	lis, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+	s.lis = s.opts.listener(lis)
+	s.l.Info("Listening...", zap.String("address", lis.Addr().String()))
+
+	go func() {
+		if err := s.srv.Serve(s.lis); err != nil && err != http.ErrServerClosed {
+			s.l.Error("Serve error.", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// Addr returns the listener address. It returns nil if the server is not started.
+func (s *DebugServer) Addr() net.Addr {
+	if s.lis == nil {
+		return nil
+	}
+	return s.lis.Addr()
+}
+
+// Shutdown gracefully stops the server.
+func (s *DebugServer) Shutdown(ctx context.Context) error {
+	err := s.srv.Shutdown(ctx)
+	if err != nil {
+		s.srv.Close()
+	}
+	return err
+}
+
+// Run starts the server and stops it when ctx is done.
+func (s *DebugServer) Run(ctx context.Context) error {
+	if err := s.Start(); err != nil {
+		return err
+	}
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), debugShutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	s.l.Info("Server stopped.")
+	return nil
+}
+
+// traceHandler is trace.Traces and trace.Events with auth instead of trace.AuthRequest.
+func traceHandler(auth func(req *http.Request) (allowed, sensitive bool), render func(w http.ResponseWriter, req *http.Request, sensitive bool)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		f := auth
+		if f == nil {
+			f = trace.AuthRequest
+		}
+		allowed, sensitive := f(req)
+		if !allowed {
+			http.Error(w, "not allowed", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		render(w, req, sensitive)
+	})
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Debug</title></head>
+<body>
+<ul>
+{{range .}}<li><a href="{{.}}">{{.}}</a></li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+func (s *DebugServer) serveIndex(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	paths := append([]string{}, s.paths...)
+	sort.Strings(paths)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	indexTemplate.Execute(w, paths)
+}
+
+// buildInfoHandler responds with build info of the binary as JSON.
+func buildInfoHandler(version string) http.Handler {
+	b := ReadBuildInfo(version)
+	type module struct {
+		Path    string `json:"path"`
+		Version string `json:"version,omitempty"`
+		Sum     string `json:"sum,omitempty"`
+	}
+	info := struct {
+		Version   string            `json:"version,omitempty"`
+		Commit    string            `json:"commit,omitempty"`
+		Branch    string            `json:"branch,omitempty"`
+		BuildDate string            `json:"build_date,omitempty"`
+		GoVersion string            `json:"go_version"`
+		Path      string            `json:"path,omitempty"`
+		Main      *module           `json:"main,omitempty"`
+		Settings  map[string]string `json:"settings,omitempty"`
+		Deps      []module          `json:"deps,omitempty"`
+	}{
+		Version:   b.Version,
+		Commit:    b.Commit,
+		Branch:    b.Branch,
+		BuildDate: b.BuildDate,
+		GoVersion: b.GoVersion,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Path = bi.Path
+		info.Main = &module{Path: bi.Main.Path, Version: bi.Main.Version, Sum: bi.Main.Sum}
+		for _, s := range bi.Settings {
+			if info.Settings == nil {
+				info.Settings = make(map[string]string)
+			}
+			info.Settings[s.Key] = s.Value
+		}
+		for _, d := range bi.Deps {
+			info.Deps = append(info.Deps, module{Path: d.Path, Version: d.Version, Sum: d.Sum})
+		}
+	}
+	body, _ := json.MarshalIndent(info, "", "  ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
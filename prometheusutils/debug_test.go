@@ -0,0 +1,92 @@
+package prometheusutils
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/trace"
+)
+
+func TestDebugServer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "debug_test_total"})
+	reg.MustRegister(c)
+	c.Inc()
+
+	s := NewDebugServer("127.0.0.1:0", WithGatherers(reg), WithExpvar(), WithBuildInfo("v1.0.0"))
+	require.NoError(t, s.Start())
+	defer s.Shutdown(context.Background())
+	base := "http://" + s.Addr().String()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(base + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+
+	code, body := get("/metrics")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "debug_test_total 1")
+	assert.NotContains(t, body, "go_goroutines")
+
+	code, body = get("/debug/buildinfo")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"version": "v1.0.0"`)
+
+	code, _ = get("/debug/vars")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = get("/debug/requests")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, body = get("/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "/debug/vars")
+
+	// pprof handlers are not registered on http.DefaultServeMux by the package
+	req, err := http.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+	require.NoError(t, err)
+	_, pattern := http.DefaultServeMux.Handler(req)
+	assert.Equal(t, "", pattern)
+}
+
+func TestDebugServerTrace(t *testing.T) {
+	tr := trace.New("debug_test", "call")
+	tr.LazyPrintf("hello")
+	tr.Finish()
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		code int
+	}{
+		{"localhost by default", []Option{WithTrace()}, http.StatusOK},
+		{"denied by auth", []Option{WithTrace(), WithTraceAuth(func(*http.Request) (bool, bool) { return false, false })}, http.StatusUnauthorized},
+		{"allowed by auth", []Option{WithTrace(), WithTraceAuth(func(*http.Request) (bool, bool) { return true, false })}, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewDebugServer("127.0.0.1:0", tc.opts...)
+			require.NoError(t, s.Start())
+			defer s.Shutdown(context.Background())
+
+			for _, path := range []string{"/debug/requests", "/debug/events"} {
+				resp, err := http.Get("http://" + s.Addr().String() + path)
+				require.NoError(t, err)
+				b, err := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				require.NoError(t, err)
+				assert.Equal(t, tc.code, resp.StatusCode, path)
+				if tc.code == http.StatusOK && path == "/debug/requests" {
+					assert.Contains(t, string(b), "debug_test")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+// Package debugpprof mounts net/http/pprof handlers on prometheusutils.DebugServer.
+//
+// Importing net/http/pprof registers its handlers on http.DefaultServeMux,
+// so do not import this package in binaries which serve http.DefaultServeMux
+// publicly, e.g. with prometheusutils.RunPrometheusServer.
+package debugpprof
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/gebv/go-utils/prometheusutils"
+)
+
+// Register mounts pprof handlers on s at /debug/pprof/.
+func Register(s *prometheusutils.DebugServer) {
+	s.Handle("/debug/pprof/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch strings.TrimPrefix(req.URL.Path, "/debug/pprof/") {
+		case "cmdline":
+			pprof.Cmdline(w, req)
+		case "profile":
+			pprof.Profile(w, req)
+		case "symbol":
+			pprof.Symbol(w, req)
+		case "trace":
+			pprof.Trace(w, req)
+		default:
+			pprof.Index(w, req)
+		}
+	}))
+}
@@ -0,0 +1,34 @@
+package debugpprof
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/gebv/go-utils/prometheusutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	s := prometheusutils.NewDebugServer("127.0.0.1:0")
+	Register(s)
+	require.NoError(t, s.Start())
+	defer s.Shutdown(context.Background())
+
+	for path, contains := range map[string]string{
+		"/debug/pprof/":          "goroutine",
+		"/debug/pprof/cmdline":   "debugpprof",
+		"/debug/pprof/goroutine": "",
+		"/":                      "/debug/pprof/",
+	} {
+		resp, err := http.Get("http://" + s.Addr().String() + path)
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+		assert.Contains(t, string(b), contains, path)
+	}
+}
@@ -0,0 +1,97 @@
+package prometheusutils
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+)
+
+// gRPC metrics labels shared by server and client metrics.
+var (
+	grpcLabels     = []string{"grpc_type", "grpc_service", "grpc_method"}
+	grpcCodeLabels = append(append([]string{}, grpcLabels...), "grpc_code")
+
+	grpcClientLabels     = append(append([]string{}, grpcLabels...), "grpc_target")
+	grpcClientCodeLabels = append(append([]string{}, grpcClientLabels...), "grpc_code")
+)
+
+// gRPC call types.
+const (
+	unary        = "unary"
+	clientStream = "client_stream"
+	serverStream = "server_stream"
+	bidiStream   = "bidi_stream"
+)
+
+var allCodes = []codes.Code{
+	codes.OK, codes.Canceled, codes.Unknown, codes.InvalidArgument, codes.DeadlineExceeded, codes.NotFound,
+	codes.AlreadyExists, codes.PermissionDenied, codes.ResourceExhausted, codes.FailedPrecondition, codes.Aborted,
+	codes.OutOfRange, codes.Unimplemented, codes.Internal, codes.Unavailable, codes.DataLoss, codes.Unauthenticated,
+}
+
+// GRPCServerMetricsOption configures gRPC server metrics.
+type GRPCServerMetricsOption interface {
+	apply(o *grpcMetricsOptions)
+}
+
+// GRPCMetricsOption configures both gRPC server and client metrics.
+type GRPCMetricsOption interface {
+	GRPCServerMetricsOption
+	clientOption()
+}
+
+type grpcServerOptionFunc func(o *grpcMetricsOptions)
+
+func (f grpcServerOptionFunc) apply(o *grpcMetricsOptions) { f(o) }
+
+type grpcOptionFunc func(o *grpcMetricsOptions)
+
+func (f grpcOptionFunc) apply(o *grpcMetricsOptions) { f(o) }
+
+func (grpcOptionFunc) clientOption() {}
+
+type grpcMetricsOptions struct {
+	buckets []float64
+	slo     *SLOTracker
+}
+
+func newGRPCMetricsOptions(opts []GRPCServerMetricsOption) *grpcMetricsOptions {
+	o := &grpcMetricsOptions{
+		buckets: prometheus.DefBuckets,
+	}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	return o
+}
+
+// WithHandlingTimeBuckets sets buckets of handling time histograms.
+// Defaults to prometheus.DefBuckets.
+func WithHandlingTimeBuckets(buckets ...float64) GRPCMetricsOption {
+	return grpcOptionFunc(func(o *grpcMetricsOptions) {
+		o.buckets = buckets
+	})
+}
+
+// grpcType returns the call type for stream flags.
+func grpcType(isClientStream, isServerStream bool) string {
+	switch {
+	case isClientStream && isServerStream:
+		return bidiStream
+	case isClientStream:
+		return clientStream
+	case isServerStream:
+		return serverStream
+	}
+	return unary
+}
+
+// splitMethodName splits "/package.Service/Method" to service and method names.
+func splitMethodName(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndexByte(fullMethod, '/'); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", "unknown"
+}
@@ -0,0 +1,250 @@
+package prometheusutils
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCClientMetrics collects metrics of gRPC calls made by clients.
+// Labels are the same as of GRPCServerMetrics plus grpc_target.
+// Register it with prometheus.Registerer and add its interceptors to the client connection.
+type GRPCClientMetrics struct {
+	started      *prometheus.CounterVec
+	handled      *prometheus.CounterVec
+	handlingTime *prometheus.HistogramVec
+	retries      *prometheus.CounterVec
+	msgReceived  *prometheus.CounterVec
+	msgSent      *prometheus.CounterVec
+}
+
+// NewGRPCClientMetrics returns metrics with names starting with prefix, for example "grpc_client".
+func NewGRPCClientMetrics(prefix string, opts ...GRPCMetricsOption) *GRPCClientMetrics {
+	o := newGRPCMetricsOptions(nil)
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	return &GRPCClientMetrics{
+		started: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_started_total",
+			Help: "The total number of RPCs started by the client.",
+		}, grpcClientLabels),
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_handled_total",
+			Help: "The total number of RPCs completed by the client by status code.",
+		}, grpcClientCodeLabels),
+		handlingTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    prefix + "_handling_seconds",
+			Help:    "Duration of RPCs until the last message or status is received by the client.",
+			Buckets: o.buckets,
+		}, grpcClientLabels),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_retries_total",
+			Help: "The total number of RPC attempts retried by the client.",
+		}, grpcClientLabels),
+		msgReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_msg_received_total",
+			Help: "The total number of stream messages received by the client.",
+		}, grpcClientLabels),
+		msgSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_msg_sent_total",
+			Help: "The total number of stream messages sent by the client.",
+		}, grpcClientLabels),
+	}
+}
+
+func (m *GRPCClientMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.started,
+		m.handled,
+		m.handlingTime,
+		m.retries,
+		m.msgReceived,
+		m.msgSent,
+	}
+}
+
+func (m *GRPCClientMetrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+func (m *GRPCClientMetrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+type attemptsCtxKey struct{}
+
+// UnaryClientInterceptor returns an interceptor recording unary calls.
+// It should be the first interceptor of the chain. Retries are counted only
+// if UnaryClientAttemptInterceptor is called on every attempt, use
+// UnaryClientRetryInterceptor to chain them around a retrying interceptor.
+func (m *GRPCClientMetrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		labels := m.start(unary, method, cc.Target())
+		attempts := atomic.NewInt32(0)
+		start := time.Now()
+		err := invoker(context.WithValue(ctx, attemptsCtxKey{}, attempts), method, req, reply, cc, opts...)
+		m.finish(labels, start, err)
+		if n := attempts.Load(); n > 1 {
+			m.retries.WithLabelValues(labels...).Add(float64(n - 1))
+		}
+		return err
+	}
+}
+
+// UnaryClientAttemptInterceptor returns an interceptor counting attempts of unary calls
+// for the retries metric. Put it in the chain after retrying interceptors,
+// so it is called on every attempt.
+func (m *GRPCClientMetrics) UnaryClientAttemptInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if attempts, ok := ctx.Value(attemptsCtxKey{}).(*atomic.Int32); ok {
+			attempts.Inc()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// UnaryClientRetryInterceptor returns UnaryClientInterceptor chained with retry
+// and UnaryClientAttemptInterceptor, so every attempt made by retry is counted.
+func (m *GRPCClientMetrics) UnaryClientRetryInterceptor(retry grpc.UnaryClientInterceptor) grpc.UnaryClientInterceptor {
+	calls, attempts := m.UnaryClientInterceptor(), m.UnaryClientAttemptInterceptor()
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return calls(ctx, method, req, reply, cc, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return retry(ctx, method, req, reply, cc, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				return attempts(ctx, method, req, reply, cc, invoker, opts...)
+			}, opts...)
+		}, opts...)
+	}
+}
+
+// StreamClientInterceptor returns an interceptor recording streaming calls and their messages.
+// A call is finished when the stream returns an error or io.EOF, the only response
+// message is received for streams without server streaming, CloseSend fails
+// or the call context is done.
+//
+// Calls are watched until the stream context is done, so streams must be
+// finished as gRPC requires: read until an error or cancel the call context.
+// Abandoned streams are not recorded and leak as gRPC streams do.
+// Taking the stream context commits the first attempt, so gRPC does not retry
+// streams.
+func (m *GRPCClientMetrics) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		labels := m.start(grpcType(desc.ClientStreams, desc.ServerStreams), method, cc.Target())
+		start := time.Now()
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			m.finish(labels, start, err)
+			return nil, err
+		}
+		s := &clientStreamMetrics{
+			ClientStream:  cs,
+			serverStreams: desc.ServerStreams,
+			received:      m.msgReceived.WithLabelValues(labels...),
+			sent:          m.msgSent.WithLabelValues(labels...),
+			finished:      make(chan struct{}),
+			finish: func(err error) {
+				m.finish(labels, start, err)
+			},
+		}
+		go s.watch(ctx, cs.Context())
+		return s, nil
+	}
+}
+
+func (m *GRPCClientMetrics) start(typ, fullMethod, target string) []string {
+	service, method := splitMethodName(fullMethod)
+	labels := []string{typ, service, method, target}
+	m.started.WithLabelValues(labels...).Inc()
+	return labels
+}
+
+func (m *GRPCClientMetrics) finish(labels []string, start time.Time, err error) {
+	m.handled.WithLabelValues(append(labels, status.Code(err).String())...).Inc()
+	m.handlingTime.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+}
+
+// clientStreamMetrics counts stream messages and records the call when the stream is finished.
+type clientStreamMetrics struct {
+	grpc.ClientStream
+	serverStreams bool
+	received      prometheus.Counter
+	sent          prometheus.Counter
+	finish        func(err error)
+	finished      chan struct{}
+	once          sync.Once
+}
+
+// done records the call once.
+func (s *clientStreamMetrics) done(err error) {
+	s.once.Do(func() {
+		s.finish(err)
+		close(s.finished)
+	})
+}
+
+// watch records the call when ctx is done before the stream is finished.
+// It returns when the stream context is done, it is derived from ctx and
+// done when gRPC finishes the stream.
+func (s *clientStreamMetrics) watch(ctx, streamCtx context.Context) {
+	select {
+	case <-streamCtx.Done():
+		if ctx.Err() == nil {
+			// finished by gRPC, the status is returned by RecvMsg
+			return
+		}
+		code := codes.Canceled
+		if ctx.Err() == context.DeadlineExceeded {
+			code = codes.DeadlineExceeded
+		}
+		s.done(status.Error(code, ctx.Err().Error()))
+	case <-s.finished:
+	}
+}
+
+func (s *clientStreamMetrics) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	if err != nil {
+		s.done(err)
+	}
+	return err
+}
+
+func (s *clientStreamMetrics) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.sent.Inc()
+	}
+	return err
+}
+
+func (s *clientStreamMetrics) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		s.received.Inc()
+		if !s.serverStreams {
+			s.done(nil)
+		}
+	case err == io.EOF:
+		s.done(nil)
+	default:
+		s.done(err)
+	}
+	return err
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*GRPCClientMetrics)(nil)
+)
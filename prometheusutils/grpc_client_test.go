@@ -0,0 +1,176 @@
+package prometheusutils
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeClientStream struct {
+	grpc.ClientStream
+	ctx      context.Context
+	messages int
+	closeErr error
+}
+
+func (s *fakeClientStream) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+func (s *fakeClientStream) CloseSend() error { return s.closeErr }
+
+func (s *fakeClientStream) SendMsg(m interface{}) error { return nil }
+
+func (s *fakeClientStream) RecvMsg(m interface{}) error {
+	if s.messages == 0 {
+		return io.EOF
+	}
+	s.messages--
+	return nil
+}
+
+func TestGRPCClientMetrics(t *testing.T) {
+	m := NewGRPCClientMetrics("grpc_client")
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(m)
+
+	cc, err := grpc.Dial("test-target", grpc.WithInsecure())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	// retrying invoker calls the attempt interceptor three times
+	attempt := m.UnaryClientAttemptInterceptor()
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		var err error
+		for i := 0; i < 3; i++ {
+			err = attempt(ctx, method, req, reply, cc, func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+				return status.Error(codes.Unavailable, "unavailable")
+			})
+		}
+		return err
+	}
+	err = m.UnaryClientInterceptor()(context.Background(), "/test.Service/Unary", nil, nil, cc, invoker)
+	require.Error(t, err)
+
+	unaryLabels := map[string]string{"grpc_type": "unary", "grpc_service": "test.Service", "grpc_method": "Unary", "grpc_target": "test-target"}
+	assert.Equal(t, 1.0, metricValue(t, reg, "grpc_client_started_total", unaryLabels))
+	assert.Equal(t, 2.0, metricValue(t, reg, "grpc_client_retries_total", unaryLabels))
+	assert.Equal(t, 1.0, metricValue(t, reg, "grpc_client_handled_total", map[string]string{"grpc_method": "Unary", "grpc_code": "Unavailable"}))
+
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	cs, err := m.StreamClientInterceptor()(context.Background(), desc, cc, "/test.Service/Stream",
+		func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeClientStream{messages: 2}, nil
+		})
+	require.NoError(t, err)
+	require.NoError(t, cs.SendMsg(nil))
+	require.NoError(t, cs.RecvMsg(nil))
+	require.NoError(t, cs.RecvMsg(nil))
+	assert.Equal(t, -1.0, metricValue(t, reg, "grpc_client_handled_total", map[string]string{"grpc_method": "Stream"}))
+	require.Equal(t, io.EOF, cs.RecvMsg(nil))
+
+	streamLabels := map[string]string{"grpc_type": "server_stream", "grpc_method": "Stream"}
+	assert.Equal(t, 2.0, metricValue(t, reg, "grpc_client_msg_received_total", streamLabels))
+	assert.Equal(t, 1.0, metricValue(t, reg, "grpc_client_msg_sent_total", streamLabels))
+	assert.Equal(t, 1.0, metricValue(t, reg, "grpc_client_handled_total", map[string]string{"grpc_method": "Stream", "grpc_code": "OK"}))
+	assert.Equal(t, 1.0, metricValue(t, reg, "grpc_client_handling_seconds", streamLabels))
+}
+
+func TestGRPCClientMetricsRetries(t *testing.T) {
+	m := NewGRPCClientMetrics("grpc_client")
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(m)
+
+	cc, err := grpc.Dial("test-target", grpc.WithInsecure())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	retry := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var err error
+		for i := 0; i < 3; i++ {
+			if err = invoker(ctx, method, req, reply, cc, opts...); err == nil {
+				break
+			}
+		}
+		return err
+	}
+	var calls int
+	invoker := func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+		if calls++; calls < 2 {
+			return status.Error(codes.Unavailable, "unavailable")
+		}
+		return nil
+	}
+	require.NoError(t, m.UnaryClientRetryInterceptor(retry)(context.Background(), "/test.Service/Unary", nil, nil, cc, invoker))
+
+	labels := map[string]string{"grpc_method": "Unary"}
+	assert.Equal(t, 1.0, metricValue(t, reg, "grpc_client_started_total", labels))
+	assert.Equal(t, 1.0, metricValue(t, reg, "grpc_client_retries_total", labels))
+	assert.Equal(t, 1.0, metricValue(t, reg, "grpc_client_handled_total", map[string]string{"grpc_method": "Unary", "grpc_code": "OK"}))
+}
+
+func TestGRPCClientMetricsStreamFinish(t *testing.T) {
+	m := NewGRPCClientMetrics("grpc_client")
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(m)
+
+	cc, err := grpc.Dial("test-target", grpc.WithInsecure())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	newStream := func(ctx context.Context, method string, fake *fakeClientStream) grpc.ClientStream {
+		cs, err := m.StreamClientInterceptor()(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, cc, method,
+			func(ctx context.Context, _ *grpc.StreamDesc, _ *grpc.ClientConn, _ string, _ ...grpc.CallOption) (grpc.ClientStream, error) {
+				if fake.ctx == nil {
+					fake.ctx = ctx
+				}
+				return fake, nil
+			})
+		require.NoError(t, err)
+		return cs
+	}
+	handled := func(method, code string) float64 {
+		return metricValue(t, reg, "grpc_client_handled_total", map[string]string{"grpc_method": method, "grpc_code": code})
+	}
+
+	// abandoned stream is finished when the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	newStream(ctx, "/test.Service/Abandoned", &fakeClientStream{messages: 1})
+	cancel()
+	for i := 0; handled("Abandoned", "Canceled") != 1; i++ {
+		require.True(t, i < 100, "stream is not finished")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cs := newStream(context.Background(), "/test.Service/CloseSend", &fakeClientStream{closeErr: status.Error(codes.Unavailable, "closed")})
+	require.Error(t, cs.CloseSend())
+	assert.Equal(t, 1.0, handled("CloseSend", "Unavailable"))
+
+	// finished stream is not recorded again on cancel
+	ctx, cancel = context.WithCancel(context.Background())
+	cs = newStream(ctx, "/test.Service/Finished", &fakeClientStream{})
+	require.NoError(t, cs.CloseSend())
+	require.Equal(t, io.EOF, cs.RecvMsg(nil))
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1.0, handled("Finished", "OK"))
+	assert.Equal(t, -1.0, handled("Finished", "Canceled"))
+
+	// stream finished by gRPC is not recorded as cancelled, RecvMsg returns its status
+	streamCtx, finish := context.WithCancel(context.Background())
+	newStream(context.Background(), "/test.Service/FinishedByGRPC", &fakeClientStream{ctx: streamCtx})
+	finish()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, -1.0, handled("FinishedByGRPC", "Canceled"))
+}
@@ -0,0 +1,169 @@
+package prometheusutils
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCServerMetrics collects metrics of gRPC calls handled by the server.
+// Register it with prometheus.Registerer and add its interceptors to the server.
+type GRPCServerMetrics struct {
+	slo *SLOTracker
+
+	started      *prometheus.CounterVec
+	handled      *prometheus.CounterVec
+	handlingTime *prometheus.HistogramVec
+	inFlight     *prometheus.GaugeVec
+	msgReceived  *prometheus.CounterVec
+	msgSent      *prometheus.CounterVec
+}
+
+// NewGRPCServerMetrics returns metrics with names starting with prefix, for example "grpc_server".
+func NewGRPCServerMetrics(prefix string, opts ...GRPCServerMetricsOption) *GRPCServerMetrics {
+	o := newGRPCMetricsOptions(opts)
+	return &GRPCServerMetrics{
+		slo: o.slo,
+		started: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_started_total",
+			Help: "The total number of RPCs started on the server.",
+		}, grpcLabels),
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_handled_total",
+			Help: "The total number of RPCs completed on the server by status code.",
+		}, grpcCodeLabels),
+		handlingTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    prefix + "_handling_seconds",
+			Help:    "Duration of RPCs handled by the server.",
+			Buckets: o.buckets,
+		}, grpcLabels),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prefix + "_in_flight",
+			Help: "The number of RPCs being handled by the server.",
+		}, grpcLabels),
+		msgReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_msg_received_total",
+			Help: "The total number of stream messages received by the server.",
+		}, grpcLabels),
+		msgSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_msg_sent_total",
+			Help: "The total number of stream messages sent by the server.",
+		}, grpcLabels),
+	}
+}
+
+func (m *GRPCServerMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.started,
+		m.handled,
+		m.handlingTime,
+		m.inFlight,
+		m.msgReceived,
+		m.msgSent,
+	}
+}
+
+func (m *GRPCServerMetrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+func (m *GRPCServerMetrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// InitializeMetrics initializes metrics of all methods registered on s with zero values,
+// so dashboards show zero rates instead of gaps. Call it after registering services.
+func (m *GRPCServerMetrics) InitializeMetrics(s *grpc.Server) {
+	for service, info := range s.GetServiceInfo() {
+		for _, method := range info.Methods {
+			labels := []string{grpcType(method.IsClientStream, method.IsServerStream), service, method.Name}
+			m.started.WithLabelValues(labels...)
+			m.handlingTime.WithLabelValues(labels...)
+			m.inFlight.WithLabelValues(labels...)
+			m.msgReceived.WithLabelValues(labels...)
+			m.msgSent.WithLabelValues(labels...)
+			for _, code := range allCodes {
+				m.handled.WithLabelValues(append(labels, code.String())...)
+			}
+		}
+	}
+}
+
+// UnaryServerInterceptor returns an interceptor recording unary calls.
+func (m *GRPCServerMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		labels := m.start(unary, info.FullMethod)
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.finish(labels, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor recording streaming calls and their messages.
+func (m *GRPCServerMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		labels := m.start(grpcType(info.IsClientStream, info.IsServerStream), info.FullMethod)
+		start := time.Now()
+		err := handler(srv, &serverStreamMetrics{
+			ServerStream: ss,
+			received:     m.msgReceived.WithLabelValues(labels...),
+			sent:         m.msgSent.WithLabelValues(labels...),
+		})
+		m.finish(labels, info.FullMethod, start, err)
+		return err
+	}
+}
+
+func (m *GRPCServerMetrics) start(typ, fullMethod string) []string {
+	service, method := splitMethodName(fullMethod)
+	labels := []string{typ, service, method}
+	m.started.WithLabelValues(labels...).Inc()
+	m.inFlight.WithLabelValues(labels...).Inc()
+	return labels
+}
+
+func (m *GRPCServerMetrics) finish(labels []string, fullMethod string, start time.Time, err error) {
+	d, code := time.Since(start), status.Code(err)
+	m.inFlight.WithLabelValues(labels...).Dec()
+	m.handled.WithLabelValues(append(labels, code.String())...).Inc()
+	m.handlingTime.WithLabelValues(labels...).Observe(d.Seconds())
+	if m.slo != nil {
+		m.slo.observe(fullMethod, code, d)
+	}
+}
+
+// serverStreamMetrics counts stream messages.
+type serverStreamMetrics struct {
+	grpc.ServerStream
+	received prometheus.Counter
+	sent     prometheus.Counter
+}
+
+func (s *serverStreamMetrics) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Inc()
+	}
+	return err
+}
+
+func (s *serverStreamMetrics) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received.Inc()
+	}
+	return err
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*GRPCServerMetrics)(nil)
+)
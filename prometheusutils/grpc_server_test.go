@@ -0,0 +1,96 @@
+package prometheusutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// metricValue returns the value of the series with the given labels or -1 if there is no such series.
+func metricValue(t *testing.T, g prometheus.Gatherer, name string, labels map[string]string) float64 {
+	t.Helper()
+	mfs, err := g.Gather()
+	require.NoError(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if v, ok := labels[lp.GetName()]; ok && v != lp.GetValue() {
+					continue metrics
+				}
+			}
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				return m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				return m.GetGauge().GetValue()
+			case dto.MetricType_HISTOGRAM:
+				return float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return -1
+}
+
+type testServer interface{}
+
+var testServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Service",
+	HandlerType: (*testServer)(nil),
+	Methods:     []grpc.MethodDesc{{MethodName: "Unary"}},
+	Streams:     []grpc.StreamDesc{{StreamName: "Bidi", ClientStreams: true, ServerStreams: true}},
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+}
+
+func (fakeServerStream) SendMsg(m interface{}) error { return nil }
+func (fakeServerStream) RecvMsg(m interface{}) error { return nil }
+
+func TestGRPCServerMetrics(t *testing.T) {
+	m := NewGRPCServerMetrics("grpc_server", WithHandlingTimeBuckets(0.1, 1))
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(m)
+
+	s := grpc.NewServer()
+	s.RegisterService(&testServiceDesc, struct{}{})
+	m.InitializeMetrics(s)
+
+	unaryLabels := map[string]string{"grpc_type": "unary", "grpc_service": "test.Service", "grpc_method": "Unary"}
+	bidiLabels := map[string]string{"grpc_type": "bidi_stream", "grpc_service": "test.Service", "grpc_method": "Bidi"}
+	assert.Equal(t, 0.0, metricValue(t, reg, "grpc_server_started_total", unaryLabels))
+	assert.Equal(t, 0.0, metricValue(t, reg, "grpc_server_handled_total", map[string]string{"grpc_method": "Bidi", "grpc_code": "Unavailable"}))
+
+	_, err := m.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test.Service/Unary"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			assert.Equal(t, 1.0, metricValue(t, reg, "grpc_server_in_flight", unaryLabels))
+			return nil, status.Error(codes.NotFound, "not found")
+		})
+	require.Error(t, err)
+	assert.Equal(t, 1.0, metricValue(t, reg, "grpc_server_started_total", unaryLabels))
+	assert.Equal(t, 0.0, metricValue(t, reg, "grpc_server_in_flight", unaryLabels))
+	assert.Equal(t, 1.0, metricValue(t, reg, "grpc_server_handled_total", map[string]string{"grpc_method": "Unary", "grpc_code": "NotFound"}))
+	assert.Equal(t, 1.0, metricValue(t, reg, "grpc_server_handling_seconds", unaryLabels))
+
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Bidi", IsClientStream: true, IsServerStream: true}
+	err = m.StreamServerInterceptor()(nil, fakeServerStream{}, info, func(srv interface{}, stream grpc.ServerStream) error {
+		require.NoError(t, stream.RecvMsg(nil))
+		require.NoError(t, stream.SendMsg(nil))
+		return stream.SendMsg(nil)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, metricValue(t, reg, "grpc_server_msg_received_total", bidiLabels))
+	assert.Equal(t, 2.0, metricValue(t, reg, "grpc_server_msg_sent_total", bidiLabels))
+	assert.Equal(t, 1.0, metricValue(t, reg, "grpc_server_handled_total", map[string]string{"grpc_method": "Bidi", "grpc_code": "OK"}))
+}
@@ -0,0 +1,80 @@
+package prometheusutils
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogMetrics counts zap log entries by level and logger name, and Sentry events by status.
+// Register it with prometheus.Registerer, wrap the logger core with Core
+// and pass SentryEvent to zapsentry as the events callback.
+type LogMetrics struct {
+	entries      *prometheus.CounterVec
+	sentryEvents *prometheus.CounterVec
+}
+
+// NewLogMetrics returns metrics with names starting with prefix.
+func NewLogMetrics(prefix string) *LogMetrics {
+	return &LogMetrics{
+		entries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_log_entries_total",
+			Help: "The total number of log entries by level and logger name.",
+		}, []string{"level", "logger"}),
+		sentryEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "_sentry_events_total",
+			Help: "The total number of Sentry events by status: sent, dropped or failed.",
+		}, []string{"status"}),
+	}
+}
+
+func (m *LogMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.entries.Describe(ch)
+	m.sentryEvents.Describe(ch)
+}
+
+func (m *LogMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.entries.Collect(ch)
+	m.sentryEvents.Collect(ch)
+}
+
+// Core returns core counting entries enabled by core, for use with zap.WrapCore.
+func (m *LogMetrics) Core(core zapcore.Core) zapcore.Core {
+	return zapcore.NewTee(core, &countingCore{LevelEnabler: core, entries: m.entries})
+}
+
+// SentryEvent counts a Sentry event with status, see zapsentry.Configuration.OnEvent.
+func (m *LogMetrics) SentryEvent(status string) {
+	m.sentryEvents.WithLabelValues(status).Inc()
+}
+
+// countingCore counts entries instead of writing them.
+type countingCore struct {
+	zapcore.LevelEnabler
+	entries *prometheus.CounterVec
+}
+
+func (c *countingCore) With(fs []zapcore.Field) zapcore.Core {
+	return c
+}
+
+func (c *countingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *countingCore) Write(ent zapcore.Entry, fs []zapcore.Field) error {
+	c.entries.WithLabelValues(ent.Level.String(), ent.LoggerName).Inc()
+	return nil
+}
+
+func (c *countingCore) Sync() error {
+	return nil
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*LogMetrics)(nil)
+	_ zapcore.Core         = (*countingCore)(nil)
+)
@@ -0,0 +1,30 @@
+package prometheusutils
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLogMetrics(t *testing.T) {
+	m := NewLogMetrics("app")
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(m)
+
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(ioutil.Discard), zap.InfoLevel)
+	l := zap.New(core, zap.WrapCore(m.Core))
+	l.Debug("debug")
+	l.Named("db").With(zap.String("k", "v")).Warn("warn")
+	l.Named("db").Warn("warn")
+	l.Error("error")
+	m.SentryEvent("sent")
+
+	assert.Equal(t, 2.0, metricValue(t, reg, "app_log_entries_total", map[string]string{"level": "warn", "logger": "db"}))
+	assert.Equal(t, 1.0, metricValue(t, reg, "app_log_entries_total", map[string]string{"level": "error", "logger": ""}))
+	assert.Equal(t, -1.0, metricValue(t, reg, "app_log_entries_total", map[string]string{"level": "debug"}))
+	assert.Equal(t, 1.0, metricValue(t, reg, "app_sentry_events_total", map[string]string{"status": "sent"}))
+}
@@ -0,0 +1,146 @@
+package prometheusutils
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/gebv/go-utils/httputils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Option configures DebugServer.
+type Option interface {
+	apply(o *options)
+}
+
+// ServerOption configures both RunPrometheusServer and DebugServer.
+type ServerOption interface {
+	Option
+	serverOption()
+}
+
+type optionFunc func(o *options)
+
+func (f optionFunc) apply(o *options) { f(o) }
+
+type serverOptionFunc func(o *options)
+
+func (f serverOptionFunc) apply(o *options) { f(o) }
+
+func (serverOptionFunc) serverOption() {}
+
+type options struct {
+	server      httputils.ServerOptions
+	gatherers   prometheus.Gatherers
+	metricsPath string
+	expvar      bool
+	trace       bool
+	traceAuth   func(req *http.Request) (allowed, sensitive bool)
+	buildInfo   bool
+	version     string
+	access      AccessRule
+	tls         *tls.Config
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		server:      httputils.DefaultServerOptions(),
+		metricsPath: "/metrics",
+	}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	return o
+}
+
+// gatherer returns gatherers merged or prometheus.DefaultGatherer.
+func (o *options) gatherer() prometheus.Gatherer {
+	if len(o.gatherers) == 0 {
+		return prometheus.DefaultGatherer
+	}
+	return o.gatherers
+}
+
+// WithServerOptions sets HTTP server timeouts and limits.
+// Defaults to httputils.DefaultServerOptions.
+func WithServerOptions(so httputils.ServerOptions) ServerOption {
+	return serverOptionFunc(func(o *options) {
+		o.server = so
+	})
+}
+
+// WithGatherers serves metrics of gatherers merged instead of prometheus.DefaultGatherer.
+func WithGatherers(gatherers ...prometheus.Gatherer) ServerOption {
+	return serverOptionFunc(func(o *options) {
+		o.gatherers = append(o.gatherers, gatherers...)
+	})
+}
+
+// WithMetricsPath sets the path of DebugServer metrics. Defaults to "/metrics".
+func WithMetricsPath(path string) Option {
+	return optionFunc(func(o *options) {
+		o.metricsPath = path
+	})
+}
+
+// WithExpvar mounts expvar handler on DebugServer at /debug/vars.
+func WithExpvar() Option {
+	return optionFunc(func(o *options) {
+		o.expvar = true
+	})
+}
+
+// WithTrace mounts golang.org/x/net/trace handlers on DebugServer
+// at /debug/requests and /debug/events. By default trace.AuthRequest allows
+// only requests from localhost, use WithTraceAuth to change it.
+func WithTrace() Option {
+	return optionFunc(func(o *options) {
+		o.trace = true
+	})
+}
+
+// WithTraceAuth sets the function authorizing requests to trace pages instead
+// of trace.AuthRequest: allowed permits viewing the pages, sensitive shows
+// sensitive events. Use it with WithAccessRules, e.g. allow everything the
+// rules allow:
+//
+//	WithTraceAuth(func(*http.Request) (bool, bool) { return true, true })
+func WithTraceAuth(auth func(req *http.Request) (allowed, sensitive bool)) Option {
+	return optionFunc(func(o *options) {
+		o.traceAuth = auth
+	})
+}
+
+// WithBuildInfo mounts build info of the binary and version on DebugServer at /debug/buildinfo.
+func WithBuildInfo(version string) Option {
+	return optionFunc(func(o *options) {
+		o.buildInfo = true
+		o.version = version
+	})
+}
+
+// WithAccessRules allows only requests allowed by all rules. Denied requests are logged.
+// Use AnyOf and AllOf to combine rules.
+func WithAccessRules(rules ...AccessRule) ServerOption {
+	return serverOptionFunc(func(o *options) {
+		o.access = AllOf(rules...)
+	})
+}
+
+// WithTLS serves over TLS with config. Set config ClientCAs and ClientAuth
+// to verify client certificates for the ClientCertificate rule.
+func WithTLS(config *tls.Config) ServerOption {
+	return serverOptionFunc(func(o *options) {
+		o.tls = config
+	})
+}
+
+// listener wraps lis with server limits and TLS.
+func (o *options) listener(lis net.Listener) net.Listener {
+	lis = o.server.Listener(lis)
+	if o.tls != nil {
+		lis = tls.NewListener(lis, o.tls)
+	}
+	return lis
+}
@@ -0,0 +1,240 @@
+package prometheusutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"go.uber.org/zap"
+)
+
+const defaultPushTimeout = 10 * time.Second
+
+// PushOption configures Pusher.
+type PushOption func(p *Pusher)
+
+// WithGrouping adds a grouping label to pushed metrics.
+func WithGrouping(name, value string) PushOption {
+	return func(p *Pusher) {
+		p.grouping[name] = value
+	}
+}
+
+// WithPushInterval sets how often Run pushes metrics. Defaults to 15 seconds.
+func WithPushInterval(d time.Duration) PushOption {
+	return func(p *Pusher) {
+		p.interval = d
+	}
+}
+
+// WithPushRetries sets how many times a failed push is retried and the delay between attempts.
+// Defaults to 3 retries with 1 second delay.
+func WithPushRetries(retries int, backoff time.Duration) PushOption {
+	return func(p *Pusher) {
+		p.retries = retries
+		p.backoff = backoff
+	}
+}
+
+// WithDeleteOnExit deletes the pushed metrics group when Run stops.
+func WithDeleteOnExit() PushOption {
+	return func(p *Pusher) {
+		p.deleteOnExit = true
+	}
+}
+
+// WithPushHTTPClient sets HTTP client. Defaults to a client with 10 seconds timeout.
+func WithPushHTTPClient(c *http.Client) PushOption {
+	return func(p *Pusher) {
+		p.client = c
+	}
+}
+
+// Pusher pushes metrics to a Pushgateway-compatible endpoint.
+// Use it for batch jobs and cron tasks which exit before they are scraped.
+type Pusher struct {
+	url          string
+	job          string
+	gatherer     prometheus.Gatherer
+	grouping     map[string]string
+	interval     time.Duration
+	retries      int
+	backoff      time.Duration
+	deleteOnExit bool
+	client       *http.Client
+	l            *zap.Logger
+}
+
+// NewPusher returns a new pusher of g metrics to the Pushgateway at url, for example "http://pushgateway:9091".
+func NewPusher(pushURL, job string, g prometheus.Gatherer, opts ...PushOption) *Pusher {
+	p := &Pusher{
+		url:      strings.TrimSuffix(pushURL, "/"),
+		job:      job,
+		gatherer: g,
+		grouping: make(map[string]string),
+		interval: 15 * time.Second,
+		retries:  3,
+		backoff:  time.Second,
+		client:   &http.Client{Timeout: defaultPushTimeout},
+		l:        zap.L().Named("pusher"),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Push gathers metrics and replaces the metrics group with them.
+func (p *Pusher) Push(ctx context.Context) error {
+	mfs, err := p.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.FmtProtoDelim)
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if _, ok := p.grouping[lp.GetName()]; ok || lp.GetName() == "job" {
+					return fmt.Errorf("metric %s has grouping label %s", mf.GetName(), lp.GetName())
+				}
+			}
+		}
+		if err := enc.Encode(mf); err != nil {
+			return err
+		}
+	}
+	return p.do(ctx, http.MethodPut, buf.Bytes())
+}
+
+// Delete deletes the metrics group.
+func (p *Pusher) Delete(ctx context.Context) error {
+	return p.do(ctx, http.MethodDelete, nil)
+}
+
+// Run pushes metrics every interval until ctx is done, then pushes them the last time
+// and deletes the group if WithDeleteOnExit is set.
+// Failed pushes are logged, Run returns the errors of the last push and delete joined.
+func (p *Pusher) Run(ctx context.Context) error {
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+
+	for {
+		if err := p.Push(ctx); err != nil && ctx.Err() == nil {
+			p.l.Error("Failed to push metrics.", zap.String("job", p.job), zap.Error(err))
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			timeout := p.client.Timeout
+			if timeout == 0 {
+				timeout = defaultPushTimeout
+			}
+			finalCtx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			pushErr := p.Push(finalCtx)
+			if pushErr != nil {
+				p.l.Error("Failed to push metrics.", zap.String("job", p.job), zap.Error(pushErr))
+			}
+			var deleteErr error
+			if p.deleteOnExit {
+				if deleteErr = p.Delete(finalCtx); deleteErr != nil {
+					p.l.Error("Failed to delete metrics.", zap.String("job", p.job), zap.Error(deleteErr))
+				}
+			}
+			return errors.Join(pushErr, deleteErr)
+		}
+	}
+}
+
+// do sends the request retrying on network errors and 5xx responses.
+func (p *Pusher) do(ctx context.Context, method string, body []byte) error {
+	var err error
+	for attempt := 0; attempt <= p.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(p.backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		var retry bool
+		retry, err = p.send(ctx, method, body)
+		if err == nil || !retry {
+			return err
+		}
+		p.l.Warn("Push attempt failed.", zap.String("method", method), zap.Int("attempt", attempt+1), zap.Error(err))
+	}
+	return err
+}
+
+func (p *Pusher) send(ctx context.Context, method string, body []byte) (bool, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, p.groupURL(), r)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", string(expfmt.FmtProtoDelim))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return false, nil
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return resp.StatusCode >= 500, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(b))
+}
+
+// groupURL returns "<url>/metrics/job/<job>/<label>/<value>...".
+func (p *Pusher) groupURL() string {
+	names := make([]string, 0, len(p.grouping))
+	for name := range p.grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(p.url + "/metrics")
+	writeGroupLabel(&b, "job", p.job)
+	for _, name := range names {
+		writeGroupLabel(&b, name, p.grouping[name])
+	}
+	return b.String()
+}
+
+// writeGroupLabel writes a path segment pair, base64 encoding values which can't be path segments.
+func writeGroupLabel(b *strings.Builder, name, value string) {
+	switch {
+	case value == "":
+		b.WriteString("/" + name + "@base64/=")
+	case strings.Contains(value, "/"):
+		b.WriteString("/" + name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value)))
+	default:
+		b.WriteString("/" + name + "/" + url.PathEscape(value))
+	}
+}
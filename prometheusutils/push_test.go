@@ -0,0 +1,88 @@
+package prometheusutils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPusher(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+		families []string
+		fail     = 1
+	)
+	gw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail > 0 {
+			fail--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		requests = append(requests, req.Method+" "+req.URL.EscapedPath())
+		if req.Method == http.MethodPut {
+			dec := expfmt.NewDecoder(req.Body, expfmt.ResponseFormat(req.Header))
+			for {
+				var mf dto.MetricFamily
+				if err := dec.Decode(&mf); err != nil {
+					break
+				}
+				families = append(families, mf.GetName())
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer gw.Close()
+
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "job_runs_total"})
+	reg.MustRegister(c)
+	c.Inc()
+
+	p := NewPusher(gw.URL, "cron", reg,
+		WithGrouping("instance", "host/1"),
+		WithGrouping("env", ""),
+		WithPushRetries(1, time.Millisecond),
+		WithPushInterval(time.Hour),
+		WithDeleteOnExit(),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, p.Run(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+	path := "/metrics/job/cron/env@base64/=/instance@base64/aG9zdC8x"
+	assert.Equal(t, []string{"PUT " + path, "DELETE " + path}, requests)
+	assert.Equal(t, []string{"job_runs_total"}, families)
+}
+
+func TestPusherRunErrors(t *testing.T) {
+	gw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPut {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer gw.Close()
+
+	p := NewPusher(gw.URL, "cron", prometheus.NewRegistry(), WithPushInterval(time.Hour), WithDeleteOnExit())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// the failed final push is returned though the group is deleted
+	err := p.Run(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected status 400")
+}
@@ -5,7 +5,6 @@ import (
 	"net"
 	"net/http"
 
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
@@ -17,7 +16,12 @@ func (l logFunc) Println(v ...interface{}) {
 }
 
 // RunPrometheusServer run debug server for prometheus.
-func RunPrometheusServer(ctx context.Context, path string, address string) {
+func RunPrometheusServer(ctx context.Context, path string, address string, opts ...ServerOption) {
+	o := newOptions(nil)
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+
 	l := zap.L().Named("debugMux")
 	sugar := l.Sugar()
 
@@ -25,7 +29,7 @@ func RunPrometheusServer(ctx context.Context, path string, address string) {
 		path = "/metrics"
 	}
 
-	http.Handle(path, promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+	http.Handle(path, promhttp.HandlerFor(o.gatherer(), promhttp.HandlerOpts{
 		ErrorLog:      logFunc(sugar.Warn),
 		ErrorHandling: promhttp.HTTPErrorOnError,
 	}))
@@ -36,8 +40,10 @@ func RunPrometheusServer(ctx context.Context, path string, address string) {
 		l.Panic("Failed to listen.", zap.String("address", address), zap.Error(err))
 	}
 	l.Info("Listening...", zap.String("address", address))
+	lis = o.listener(lis)
 
-	s := &http.Server{}
+	s := &http.Server{Handler: accessHandler(o.access, l, http.DefaultServeMux)}
+	o.server.Configure(s)
 	go func() {
 		if err := s.Serve(lis); err != nil && err != http.ErrServerClosed {
 			l.Error("Serve error.", zap.Error(err))
@@ -0,0 +1,294 @@
+package prometheusutils
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// SLO is a service level objective of a gRPC method.
+// A call is bad if it fails with a server error code or takes longer than LatencyThreshold.
+type SLO struct {
+	// Method is a full method name "/package.Service/Method".
+	Method string
+	// Objective is the target ratio of good calls, for example 0.999.
+	Objective float64
+	// LatencyThreshold makes slower calls bad. Zero disables the latency objective.
+	LatencyThreshold time.Duration
+}
+
+// Burn rate windows. Fast burn is detected over 1h and 5m windows, slow burn over 6h and 30m.
+var sloWindows = []time.Duration{5 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour}
+
+const (
+	sloBucket        = time.Minute
+	sloBudgetBuckets = 720
+)
+
+// serverErrorCodes are codes which count against the error budget.
+var serverErrorCodes = map[codes.Code]bool{
+	codes.Unknown:           true,
+	codes.DeadlineExceeded:  true,
+	codes.ResourceExhausted: true,
+	codes.Unimplemented:     true,
+	codes.Internal:          true,
+	codes.Unavailable:       true,
+	codes.DataLoss:          true,
+}
+
+// SLOOption configures SLOTracker.
+type SLOOption func(t *SLOTracker)
+
+// WithBudgetWindow sets the error budget period. Defaults to 30 days.
+// Periods shorter than a minute are set to a minute.
+func WithBudgetWindow(d time.Duration) SLOOption {
+	return func(t *SLOTracker) {
+		t.budgetWindow = d
+	}
+}
+
+// WithFastBurnWarning makes Run log a warning when burn rates over both 1h and 5m windows
+// cross threshold, for example 14.4 which spends 2% of a 30 days budget in an hour.
+func WithFastBurnWarning(threshold float64) SLOOption {
+	return func(t *SLOTracker) {
+		t.fastBurn = threshold
+	}
+}
+
+// SLOTracker computes multi-window burn rates and remaining error budgets of SLOs
+// in-process from calls recorded by GRPCServerMetrics (see WithSLOTracker).
+// Register it with prometheus.Registerer to export burn rate and budget gauges.
+type SLOTracker struct {
+	slos         map[string]*sloState
+	budgetWindow time.Duration
+	fastBurn     float64
+	now          func() time.Time
+	l            *zap.Logger
+
+	burnRate  *prometheus.Desc
+	budget    *prometheus.Desc
+	objective *prometheus.Desc
+}
+
+// NewSLOTracker returns a tracker of slos with metric names starting with prefix.
+func NewSLOTracker(prefix string, slos []SLO, opts ...SLOOption) *SLOTracker {
+	t := &SLOTracker{
+		slos:         make(map[string]*sloState),
+		budgetWindow: 30 * 24 * time.Hour,
+		now:          time.Now,
+		l:            zap.L().Named("slo"),
+		burnRate: prometheus.NewDesc(prefix+"_slo_burn_rate",
+			"Error budget burn rate over the window, 1 spends the budget exactly in the budget period.", []string{"method", "window"}, nil),
+		budget: prometheus.NewDesc(prefix+"_slo_error_budget_remaining",
+			"Remaining ratio of the error budget over the budget period, negative when exhausted.", []string{"method"}, nil),
+		objective: prometheus.NewDesc(prefix+"_slo_objective",
+			"Target ratio of good calls.", []string{"method"}, nil),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.budgetWindow < sloBucket {
+		t.budgetWindow = sloBucket
+	}
+	for _, slo := range slos {
+		t.slos[slo.Method] = &sloState{
+			SLO:    slo,
+			recent: newSLORing(sloBucket, int(sloWindows[len(sloWindows)-1]/sloBucket)),
+			period: newSLORing(t.budgetWindow/sloBudgetBuckets, sloBudgetBuckets),
+		}
+	}
+	return t
+}
+
+// WithSLOTracker records calls handled by GRPCServerMetrics interceptors in t.
+func WithSLOTracker(t *SLOTracker) GRPCServerMetricsOption {
+	return grpcServerOptionFunc(func(o *grpcMetricsOptions) {
+		o.slo = t
+	})
+}
+
+// observe records a finished call.
+func (t *SLOTracker) observe(fullMethod string, code codes.Code, d time.Duration) {
+	s, ok := t.slos[fullMethod]
+	if !ok {
+		return
+	}
+	bad := serverErrorCodes[code] || (s.LatencyThreshold > 0 && d > s.LatencyThreshold)
+	now := t.now()
+
+	s.mu.Lock()
+	s.recent.add(now, bad)
+	s.period.add(now, bad)
+	s.mu.Unlock()
+}
+
+// BurnRate returns the burn rate of the method SLO over window.
+func (t *SLOTracker) BurnRate(method string, window time.Duration) float64 {
+	s, ok := t.slos[method]
+	if !ok {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.burnRate(s.recent.sum(t.now(), window))
+}
+
+// ErrorBudgetRemaining returns the remaining ratio of the method error budget.
+func (t *SLOTracker) ErrorBudgetRemaining(method string) float64 {
+	s, ok := t.slos[method]
+	if !ok {
+		return 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return 1 - s.burnRate(s.period.sum(t.now(), t.budgetWindow))
+}
+
+// Run checks fast burn every minute until ctx is done. It does nothing without WithFastBurnWarning.
+func (t *SLOTracker) Run(ctx context.Context) {
+	if t.fastBurn <= 0 {
+		return
+	}
+	tick := time.NewTicker(sloBucket)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			t.checkFastBurn()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkFastBurn logs a warning when a method starts burning fast.
+func (t *SLOTracker) checkFastBurn() {
+	for method, s := range t.slos {
+		long, short := t.BurnRate(method, time.Hour), t.BurnRate(method, 5*time.Minute)
+		burning := long > t.fastBurn && short > t.fastBurn
+
+		s.mu.Lock()
+		crossed := burning && !s.burning
+		s.burning = burning
+		s.mu.Unlock()
+
+		if crossed {
+			t.l.Warn("SLO error budget is burning fast.", zap.String("method", method),
+				zap.Float64("burn_rate_1h", long), zap.Float64("burn_rate_5m", short), zap.Float64("threshold", t.fastBurn))
+		}
+	}
+}
+
+func (t *SLOTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.burnRate
+	ch <- t.budget
+	ch <- t.objective
+}
+
+func (t *SLOTracker) Collect(ch chan<- prometheus.Metric) {
+	methods := make([]string, 0, len(t.slos))
+	for method := range t.slos {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	for _, method := range methods {
+		for _, w := range sloWindows {
+			ch <- prometheus.MustNewConstMetric(t.burnRate, prometheus.GaugeValue, t.BurnRate(method, w), method, windowLabel(w))
+		}
+		ch <- prometheus.MustNewConstMetric(t.budget, prometheus.GaugeValue, t.ErrorBudgetRemaining(method), method)
+		ch <- prometheus.MustNewConstMetric(t.objective, prometheus.GaugeValue, t.slos[method].Objective, method)
+	}
+}
+
+// windowLabel formats windows as "5m" and "1h".
+func windowLabel(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return strconv.Itoa(int(d/time.Hour)) + "h"
+	}
+	return strconv.Itoa(int(d/time.Minute)) + "m"
+}
+
+type sloState struct {
+	SLO
+
+	mu      sync.Mutex
+	recent  *sloRing
+	period  *sloRing
+	burning bool
+}
+
+// burnRate returns the ratio of bad calls to the allowed ratio.
+func (s *sloState) burnRate(bad, total uint64) float64 {
+	if total == 0 || s.Objective >= 1 {
+		return 0
+	}
+	return float64(bad) / float64(total) / (1 - s.Objective)
+}
+
+// sloRing counts calls in time buckets.
+type sloRing struct {
+	width time.Duration
+	bad   []uint64
+	total []uint64
+	last  int64
+}
+
+func newSLORing(width time.Duration, n int) *sloRing {
+	return &sloRing{
+		width: width,
+		bad:   make([]uint64, n),
+		total: make([]uint64, n),
+	}
+}
+
+// advance clears buckets between the last used bucket and now, and returns the current bucket index.
+func (r *sloRing) advance(now time.Time) int64 {
+	idx := now.UnixNano() / int64(r.width)
+	n := int64(len(r.total))
+	if idx <= r.last {
+		return r.last
+	}
+	for i := r.last + 1; i <= idx && i <= r.last+n; i++ {
+		r.bad[i%n] = 0
+		r.total[i%n] = 0
+	}
+	r.last = idx
+	return idx
+}
+
+func (r *sloRing) add(now time.Time, bad bool) {
+	idx := r.advance(now) % int64(len(r.total))
+	r.total[idx]++
+	if bad {
+		r.bad[idx]++
+	}
+}
+
+// sum returns bad and total calls over the window ending now.
+func (r *sloRing) sum(now time.Time, window time.Duration) (uint64, uint64) {
+	idx := r.advance(now)
+	n := int64(len(r.total))
+	k := int64((window + r.width - 1) / r.width)
+	if k > n {
+		k = n
+	}
+	var bad, total uint64
+	for i := idx - k + 1; i <= idx; i++ {
+		bad += r.bad[i%n]
+		total += r.total[i%n]
+	}
+	return bad, total
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*SLOTracker)(nil)
+)
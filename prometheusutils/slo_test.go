@@ -0,0 +1,64 @@
+package prometheusutils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSLOTracker(t *testing.T) {
+	const method = "/test.Service/Unary"
+	tracker := NewSLOTracker("app", []SLO{{Method: method, Objective: 0.9, LatencyThreshold: time.Second}})
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+
+	m := NewGRPCServerMetrics("grpc_server", WithSLOTracker(tracker))
+	interceptor := m.UnaryServerInterceptor()
+	call := func(err error) {
+		interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) { return nil, err })
+	}
+
+	// 2 bad of 10 calls in the hour before, client errors are good
+	for i := 0; i < 8; i++ {
+		call(status.Error(codes.InvalidArgument, "invalid"))
+	}
+	call(status.Error(codes.Unavailable, "unavailable"))
+	tracker.observe(method, codes.OK, 2*time.Second)
+
+	now = now.Add(time.Hour)
+	for i := 0; i < 10; i++ {
+		call(nil)
+	}
+
+	assert.InDelta(t, 0, tracker.BurnRate(method, 5*time.Minute), 1e-9)
+	assert.InDelta(t, 1, tracker.BurnRate(method, 6*time.Hour), 1e-9)
+	assert.InDelta(t, 0, tracker.ErrorBudgetRemaining(method), 1e-9)
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(tracker))
+	assert.InDelta(t, 1, metricValue(t, reg, "app_slo_burn_rate", map[string]string{"method": method, "window": "6h"}), 1e-9)
+	assert.Equal(t, 0.9, metricValue(t, reg, "app_slo_objective", map[string]string{"method": method}))
+
+	// the hour before is out of all windows a week later
+	now = now.Add(7 * 24 * time.Hour)
+	assert.Equal(t, 0.0, tracker.BurnRate(method, 6*time.Hour))
+	assert.InDelta(t, 0, tracker.ErrorBudgetRemaining(method), 1e-9)
+}
+
+func TestSLOTrackerShortBudgetWindow(t *testing.T) {
+	const method = "/test.Service/Unary"
+	for _, d := range []time.Duration{0, time.Nanosecond, 719 * time.Nanosecond} {
+		tracker := NewSLOTracker("app", []SLO{{Method: method, Objective: 0.9}}, WithBudgetWindow(d))
+		tracker.observe(method, codes.Internal, 0)
+		assert.Equal(t, time.Minute, tracker.budgetWindow)
+		assert.InDelta(t, -9, tracker.ErrorBudgetRemaining(method), 1e-9)
+	}
+}
@@ -32,6 +32,11 @@ type LoggerConfig struct {
 	EnableDevelopmentLogger bool
 	EnableDebugLevelLogger  bool
 	Version                 string
+	// WrapCore wraps the logger core if set, e.g. prometheusutils.LogMetrics.Core.
+	WrapCore func(zapcore.Core) zapcore.Core
+	// OnSentryEvent is called with the status of each Sentry event if set,
+	// e.g. prometheusutils.LogMetrics.SentryEvent.
+	OnSentryEvent func(status string)
 }
 
 func SetLogger(s *LoggerConfig) func() error {
@@ -47,13 +52,17 @@ func SetLogger(s *LoggerConfig) func() error {
 
 	raven.CaptureMessageAndWait("Start application", nil)
 
-	sentryCore, err := zapsentry.Configuration{
+	sentryConfig := zapsentry.Configuration{
 		DSN: dsn,
 		Tags: map[string]string{
 			"host": host,
 		},
 		Release: s.Version,
-	}.Build()
+	}
+	if s.OnSentryEvent != nil {
+		sentryConfig.OnEvent = s.OnSentryEvent
+	}
+	sentryCore, err := sentryConfig.Build()
 	if err != nil {
 		zap.L().Panic("Failed to create Sentry logger.", zap.Error(err))
 	}
@@ -81,7 +90,11 @@ func SetLogger(s *LoggerConfig) func() error {
 	l, err := config.Build(
 		zap.AddStacktrace(zap.ErrorLevel),
 		zap.WrapCore(func(core zapcore.Core) zapcore.Core {
-			return zapcore.NewTee(core, sentryCore)
+			core = zapcore.NewTee(core, sentryCore)
+			if s.WrapCore != nil {
+				core = s.WrapCore(core)
+			}
+			return core
 		}),
 	)
 	if err != nil {
@@ -21,6 +21,7 @@ type option struct {
 	release      string
 	sentryTags   map[string]string
 	sentrtFields []zapcore.Field
+	onEvent      func(status string)
 }
 
 func init() {
@@ -48,6 +49,13 @@ func WithRelease(release string) Option {
 	}
 }
 
+// WithSentryEvents sets a callback of captured Sentry event statuses, see Configuration.OnEvent.
+func WithSentryEvents(onEvent func(status string)) Option {
+	return func(o *option) {
+		o.onEvent = onEvent
+	}
+}
+
 func S() *zap.SugaredLogger {
 	return logger
 }
@@ -76,6 +84,7 @@ func createLoagger(o *option) *zap.Logger {
 		DSN:     o.sentryDns,
 		Tags:    o.sentryTags,
 		Release: o.release,
+		OnEvent: o.onEvent,
 	}
 
 	sentryCore, err := cfg.Build()
@@ -38,12 +38,22 @@ type client interface {
 	Wait()
 }
 
+// Sentry event statuses reported to Configuration.OnEvent.
+const (
+	EventSent    = "sent"
+	EventDropped = "dropped"
+	EventFailed  = "failed"
+)
+
 // Configuration is a minimal set of parameters for Sentry integration.
 type Configuration struct {
 	DSN     string `yaml:"DSN"`
 	Tags    map[string]string
 	Trace   trace
 	Release string
+	// OnEvent is called with EventSent, EventDropped or EventFailed status
+	// for every captured event. It may be called from another goroutine.
+	OnEvent func(status string) `yaml:"-"`
 }
 
 type trace struct {
@@ -66,8 +76,9 @@ type core struct {
 	zapcore.LevelEnabler
 	trace
 
-	fields map[string]interface{}
-	tags   map[string]string
+	fields  map[string]interface{}
+	tags    map[string]string
+	onEvent func(status string)
 }
 
 func newCore(cfg Configuration, c client, enab zapcore.LevelEnabler) *core {
@@ -77,6 +88,7 @@ func newCore(cfg Configuration, c client, enab zapcore.LevelEnabler) *core {
 		trace:        cfg.Trace,
 		fields:       make(map[string]interface{}),
 		tags:         cfg.Tags,
+		onEvent:      cfg.OnEvent,
 	}
 	return sentryCore
 }
@@ -115,7 +127,7 @@ func (c *core) Write(ent zapcore.Entry, fs []zapcore.Field) error {
 		}
 	}
 
-	_, _ = c.Capture(packet, c.tags)
+	c.report(c.Capture(packet, c.tags))
 
 	// We may be crashing the program, so should flush any buffered events.
 	if ent.Level > zapcore.ErrorLevel {
@@ -124,6 +136,41 @@ func (c *core) Write(ent zapcore.Entry, fs []zapcore.Field) error {
 	return nil
 }
 
+// report reports the status of a captured event to onEvent without blocking.
+func (c *core) report(eventID string, ch chan error) {
+	if c.onEvent == nil || ch == nil {
+		return
+	}
+
+	// dropped or failed events are reported by raven synchronously
+	select {
+	case err, ok := <-ch:
+		switch {
+		case !ok, err == raven.ErrPacketDropped:
+			c.onEvent(EventDropped)
+		case err != nil:
+			c.onEvent(EventFailed)
+		default:
+			c.onEvent(EventSent)
+		}
+		return
+	default:
+	}
+
+	// sampled out and excluded events are never reported to ch
+	if eventID == "" {
+		c.onEvent(EventDropped)
+		return
+	}
+	go func() {
+		if err := <-ch; err != nil {
+			c.onEvent(EventFailed)
+		} else {
+			c.onEvent(EventSent)
+		}
+	}()
+}
+
 func (c *core) Sync() error {
 	c.client.Wait()
 	return nil
@@ -152,5 +199,6 @@ func (c *core) with(fs []zapcore.Field) *core {
 		LevelEnabler: c.LevelEnabler,
 		trace:        c.trace,
 		fields:       m,
+		onEvent:      c.onEvent,
 	}
 }
@@ -150,6 +150,46 @@ func TestConfigWrite(t *testing.T) {
 	assert.Equal(t, "TestConfigWrite", frame.Function, "Expected frame to point to this test function.")
 }
 
+// eventClient captures events with the given result.
+type eventClient struct {
+	eventID string
+	result  func(ch chan error)
+}
+
+func (c *eventClient) Capture(p *raven.Packet, tags map[string]string) (string, chan error) {
+	ch := make(chan error, 1)
+	c.result(ch)
+	return c.eventID, ch
+}
+
+func (c *eventClient) Wait() {}
+
+func TestEventStatuses(t *testing.T) {
+	t.Parallel()
+	queued := make(chan chan error, 1)
+	tests := []struct {
+		client *eventClient
+		status string
+	}{
+		{&eventClient{"id", func(ch chan error) { ch <- raven.ErrPacketDropped }}, EventDropped},
+		{&eventClient{"", func(ch chan error) {}}, EventDropped},
+		{&eventClient{"", func(ch chan error) { ch <- errors.New("invalid packet") }}, EventFailed},
+		{&eventClient{"id", func(ch chan error) { queued <- ch }}, EventSent},
+	}
+
+	for _, tt := range tests {
+		statuses := make(chan string, 1)
+		core := newCore(Configuration{OnEvent: func(status string) { statuses <- status }}, tt.client, zapcore.ErrorLevel)
+		require.NoError(t, core.Write(zapcore.Entry{Message: "oh no", Level: zapcore.ErrorLevel}, nil))
+		select {
+		case ch := <-queued:
+			ch <- nil
+		default:
+		}
+		assert.Equal(t, tt.status, <-statuses)
+	}
+}
+
 func TestConfigBuild(t *testing.T) {
 	t.Parallel()
 	broken := Configuration{DSN: "invalid"}